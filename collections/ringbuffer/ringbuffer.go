@@ -105,7 +105,7 @@ func (r *T[C]) Seq(seqMode SeqMode) func(yield func(uint64, C) bool) {
 		maxWritable := armath.Min(head, r.buflen)
 
 		if seqMode == SEQ_MODE_FIFO {
-			start := (((head - 1) % r.buflen) - maxWritable) % r.buflen
+			start := (head - maxWritable) % r.buflen
 
 			for i := range maxWritable {
 				idx := (start + i) % r.buflen
@@ -26,6 +26,33 @@ func TestRange(t *testing.T) {
 	}
 }
 
+func TestRangeOddSize(t *testing.T) {
+	rb, err := New[int](7)
+	require.NoError(t, err)
+
+	for i := range 3 {
+		rb.Push(i)
+	}
+	expected := []int{0, 1, 2}
+	cnt := 0
+	for i, v := range rb.Seq(SEQ_MODE_FIFO) {
+		require.Equal(t, expected[i], v)
+		cnt++
+	}
+	require.Equal(t, len(expected), cnt)
+
+	for i := 3; i < 9; i++ {
+		rb.Push(i)
+	}
+	expected = []int{2, 3, 4, 5, 6, 7, 8}
+	cnt = 0
+	for i, v := range rb.Seq(SEQ_MODE_FIFO) {
+		require.Equal(t, expected[i], v)
+		cnt++
+	}
+	require.Equal(t, len(expected), cnt)
+}
+
 func TestCycledRingBuffer(t *testing.T) {
 	rb, err := New[string](5)
 	require.NoError(t, err)
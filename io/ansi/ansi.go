@@ -0,0 +1,270 @@
+// Package ansi removes ANSI escape sequences from terminal output.
+package ansi
+
+import (
+	"io"
+)
+
+// maxCollapseLine bounds the line being rendered in collapse mode. A longer
+// line is emitted as is, without waiting for its newline.
+const maxCollapseLine = 64 * 1024
+
+// maxParams bounds the number of CSI parameters kept.
+const maxParams = 4
+
+type state int
+
+const (
+	stateGround state = iota
+	stateEscape
+	stateEscapeIntermediate
+	stateCSI
+	stateString
+	stateStringEscape
+)
+
+const (
+	bel = 0x07
+	bs  = 0x08
+	can = 0x18
+	sub = 0x1a
+	esc = 0x1b
+)
+
+// Stripper is an io.Reader that removes CSI, OSC and other escape sequences
+// from the wrapped reader. Its state is kept across reads, so sequences split
+// between two reads are removed as well.
+//
+// In collapse mode, carriage returns, backspaces and cursor movements are
+// interpreted so that a progress bar redrawn on the same line comes out as
+// its final visible text. Columns are counted in bytes.
+type Stripper struct {
+	reader    io.Reader
+	readerErr error
+	inbuf     []byte
+	out       []byte
+	pending   []byte
+
+	collapse bool
+	state    state
+	params   [maxParams]int
+	nparams  int
+
+	// line being rendered in collapse mode, and the cursor position in it
+	line []byte
+	col  int
+}
+
+func NewStripper(reader io.Reader, blockSize uint, collapse bool) *Stripper {
+	s := &Stripper{}
+	NewStripperInto(s, reader, blockSize, collapse)
+	return s
+}
+
+func NewStripperInto(dst *Stripper, reader io.Reader, blockSize uint, collapse bool) {
+	*dst = Stripper{
+		reader:   reader,
+		inbuf:    make([]byte, blockSize),
+		collapse: collapse,
+	}
+}
+
+func (s *Stripper) Read(dst []byte) (n int, err error) {
+	for len(s.pending) == 0 {
+		if s.readerErr != nil {
+			return 0, s.readerErr
+		}
+
+		var rn int
+		rn, s.readerErr = s.reader.Read(s.inbuf)
+		s.out = s.process(s.out[:0], s.inbuf[:rn])
+		if s.readerErr != nil && s.collapse {
+			s.out = append(s.out, s.line...)
+			s.line = s.line[:0]
+		}
+		s.pending = s.out
+	}
+
+	n = copy(dst, s.pending)
+	s.pending = s.pending[n:]
+	return n, nil
+}
+
+// Strip appends src without its escape sequences to dst.
+func Strip(dst, src []byte) []byte {
+	s := Stripper{}
+	return s.process(dst, src)
+}
+
+func (s *Stripper) process(dst, src []byte) []byte {
+	for _, c := range src {
+		switch s.state {
+		case stateGround:
+			switch {
+			case c == esc:
+				s.state = stateEscape
+			case s.collapse:
+				dst = s.render(dst, c)
+			default:
+				dst = append(dst, c)
+			}
+
+		case stateEscape:
+			switch {
+			case c == '[':
+				s.state = stateCSI
+				s.nparams = 0
+				s.params = [maxParams]int{}
+			case c == ']' || c == 'P' || c == 'X' || c == '^' || c == '_':
+				// OSC, DCS, SOS, PM and APC are strings ended by ST or BEL
+				s.state = stateString
+			case c >= 0x20 && c <= 0x2f:
+				s.state = stateEscapeIntermediate
+			case c == esc:
+			case c < 0x20:
+				dst = s.abort(dst, c)
+			default:
+				s.state = stateGround
+			}
+
+		case stateEscapeIntermediate:
+			switch {
+			case c >= 0x30 && c <= 0x7e:
+				s.state = stateGround
+			case c < 0x20:
+				dst = s.abort(dst, c)
+			}
+
+		case stateCSI:
+			switch {
+			case c >= '0' && c <= '9':
+				if s.nparams == 0 {
+					s.nparams = 1
+				}
+				if p := &s.params[s.nparams-1]; *p < 1<<16 {
+					*p = *p*10 + int(c-'0')
+				}
+			case c == ';':
+				if s.nparams == 0 {
+					s.nparams = 1
+				}
+				if s.nparams < maxParams {
+					s.nparams++
+				}
+			case c >= 0x20 && c <= 0x3f:
+				// intermediates and private markers
+			case c >= 0x40 && c <= 0x7e:
+				s.state = stateGround
+				if s.collapse {
+					s.csi(c)
+				}
+			default:
+				dst = s.abort(dst, c)
+			}
+
+		case stateString:
+			switch c {
+			case bel:
+				s.state = stateGround
+			case esc:
+				s.state = stateStringEscape
+			case '\n', can, sub:
+				dst = s.abort(dst, c)
+			}
+
+		case stateStringEscape:
+			if c == '\\' {
+				s.state = stateGround
+			} else {
+				// an unterminated string followed by a new sequence
+				s.state = stateEscape
+				dst = s.process(dst, []byte{c})
+			}
+		}
+	}
+	return dst
+}
+
+// abort cancels the current sequence. Newlines are kept so that a broken
+// sequence can't swallow the following lines.
+func (s *Stripper) abort(dst []byte, c byte) []byte {
+	s.state = stateGround
+	if c != '\n' {
+		return dst
+	}
+	if s.collapse {
+		return s.render(dst, c)
+	}
+	return append(dst, c)
+}
+
+// render applies a byte to the line being rendered in collapse mode.
+func (s *Stripper) render(dst []byte, c byte) []byte {
+	switch c {
+	case '\n':
+		dst = append(dst, s.line...)
+		dst = append(dst, '\n')
+		s.line = s.line[:0]
+		s.col = 0
+	case '\r':
+		s.col = 0
+	case bs:
+		s.col = max(0, s.col-1)
+	default:
+		s.pad()
+		if s.col < len(s.line) {
+			s.line[s.col] = c
+		} else {
+			s.line = append(s.line, c)
+		}
+		s.col++
+
+		if len(s.line) >= maxCollapseLine {
+			dst = append(dst, s.line...)
+			s.line = s.line[:0]
+			s.col = 0
+		}
+	}
+	return dst
+}
+
+func (s *Stripper) param(i, def int) int {
+	if i >= s.nparams || s.params[i] == 0 {
+		return def
+	}
+	return s.params[i]
+}
+
+// csi applies the cursor movements and erasures that change the visible text
+// of the current line.
+func (s *Stripper) csi(final byte) {
+	switch final {
+	case 'D': // cursor back
+		s.col = max(0, s.col-s.param(0, 1))
+	case 'C': // cursor forward
+		s.col += s.param(0, 1)
+		s.pad()
+	case 'G': // cursor horizontal absolute
+		s.col = s.param(0, 1) - 1
+		s.pad()
+	case 'K': // erase in line
+		switch s.param(0, 0) {
+		case 0:
+			s.line = s.line[:min(s.col, len(s.line))]
+		case 1:
+			for i := 0; i < min(s.col+1, len(s.line)); i++ {
+				s.line[i] = ' '
+			}
+		case 2:
+			s.line = s.line[:0]
+		}
+	}
+}
+
+// pad extends the line with spaces up to the cursor.
+func (s *Stripper) pad() {
+	s.col = min(s.col, maxCollapseLine-1)
+	for len(s.line) < s.col {
+		s.line = append(s.line, ' ')
+	}
+}
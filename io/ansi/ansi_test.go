@@ -0,0 +1,60 @@
+package ansi_test
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/asymmetric-research/go-commons/io/ansi"
+	"github.com/stretchr/testify/require"
+)
+
+const colored = "\x1b[1;31merror\x1b[0m: build failed\n" +
+	"\x1b]0;window title\x07plain \x1b]8;;http://example.com\x1b\\link\x1b]8;;\x1b\\\n" +
+	"\x1b(Bcharset \x1b[?25lhidden cursor\x1b[?25h\n"
+
+const stripped = "error: build failed\nplain link\ncharset hidden cursor\n"
+
+func readAll(t *testing.T, r io.Reader) string {
+	out, err := io.ReadAll(r)
+	require.NoError(t, err)
+	return string(out)
+}
+
+func TestStrip(t *testing.T) {
+	require.Equal(t, stripped, string(ansi.Strip(nil, []byte(colored))))
+
+	// sequences split across reads
+	for _, wrap := range []func(io.Reader) io.Reader{iotest.OneByteReader, iotest.HalfReader, iotest.DataErrReader} {
+		r := ansi.NewStripper(wrap(strings.NewReader(colored)), 3, false)
+		require.Equal(t, stripped, readAll(t, r))
+	}
+}
+
+func TestStripKeepsCarriageReturns(t *testing.T) {
+	in := "10%\r50%\r100%\n"
+	require.Equal(t, in, readAll(t, ansi.NewStripper(strings.NewReader(in), 16, false)))
+}
+
+func TestBrokenSequenceKeepsNewline(t *testing.T) {
+	in := "a\x1b]unterminated title\nnext line\n\x1b[12\nafter csi\n"
+	require.Equal(t, "a\nnext line\n\nafter csi\n", readAll(t, ansi.NewStripper(strings.NewReader(in), 16, false)))
+}
+
+func TestCollapse(t *testing.T) {
+	for in, expected := range map[string]string{
+		"downloading  10%\rdownloading  50%\rdownloading 100%\ndone\n":       "downloading 100%\ndone\n",
+		"\x1b[32mprogress [##   ]\x1b[0m\r\x1b[32mprogress [#####]\x1b[0m\n": "progress [#####]\n",
+		"12345\x1b[3Dab\n":                "12ab5\n",
+		"long status line\r\x1b[Kshort\n": "short\n",
+		"abc\b\bX\n":                      "aXc\n",
+		"a\x1b[5Gb\n":                     "a   b\n",
+		"line\r\n":                        "line\n",
+		"no newline\rat eof":              "at eofline",
+		"xxxxx\x1b[2Kab\n":                "     ab\n",
+	} {
+		r := ansi.NewStripper(iotest.OneByteReader(strings.NewReader(in)), 4, true)
+		require.Equal(t, expected, readAll(t, r), "%q", in)
+	}
+}
@@ -0,0 +1,289 @@
+// Package extsort sorts line streams that don't fit in memory. Lines are
+// read into sorted runs under a memory budget, runs are spilled to temporary
+// files and then k-way merged.
+package extsort
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+
+	"github.com/asymmetric-research/go-commons/io/linereader"
+)
+
+// checkEvery is how many lines are processed between context checks.
+const checkEvery = 1024
+
+// defaultMaxFanIn is the number of runs merged at once when Config.MaxFanIn
+// is zero.
+const defaultMaxFanIn = 64
+
+type UniqMode int
+
+const (
+	// UNIQ_MODE_NONE keeps duplicate lines, like sort(1)
+	UNIQ_MODE_NONE UniqMode = iota
+	// UNIQ_MODE_UNIQ keeps one line of every run of equal lines, like sort -u
+	UNIQ_MODE_UNIQ
+	// UNIQ_MODE_COUNT prefixes every unique line with its count, like uniq -c
+	UNIQ_MODE_COUNT
+)
+
+type Config struct {
+	// MemoryBudget is the number of line bytes held in memory before a run is
+	// spilled to disk.
+	MemoryBudget int
+	// MaxLineSize is the longest accepted line. Longer lines fail the sort
+	// with a *linereader.ErrLineTruncated rather than being sorted truncated.
+	MaxLineSize int
+	// BlockSize is the read block size used for the input and the runs.
+	BlockSize uint
+	// Compare orders lines, it defaults to bytes.Compare. Lines comparing
+	// equal are considered duplicates by the uniq modes.
+	Compare func(a, b []byte) int
+	Uniq    UniqMode
+	// TempDir is where runs are spilled, it defaults to os.TempDir.
+	TempDir string
+	// MaxFanIn is the most runs merged at once, each one being an open file.
+	// With more runs, they are merged into fewer, larger runs first. It
+	// defaults to 64.
+	MaxFanIn int
+}
+
+// span locates a line in the arena
+type span struct {
+	off, length int
+}
+
+type sorter struct {
+	ctx context.Context
+	cfg Config
+
+	tmpdir string
+	runs   []string
+
+	arena []byte
+	spans []span
+}
+
+// Sort reads every line of r and writes them sorted to w, each followed by a
+// newline. Temporary files are removed before Sort returns, including when it
+// fails or ctx is cancelled.
+func Sort(ctx context.Context, r io.Reader, w io.Writer, cfg Config) (err error) {
+	if cfg.MemoryBudget <= 0 || cfg.MaxLineSize <= 0 || cfg.BlockSize == 0 {
+		return fmt.Errorf("memory budget, max line size and block size must be greater than zero")
+	}
+	if cfg.Compare == nil {
+		cfg.Compare = bytes.Compare
+	}
+	if cfg.MaxFanIn == 0 {
+		cfg.MaxFanIn = defaultMaxFanIn
+	}
+	if cfg.MaxFanIn < 2 {
+		return fmt.Errorf("max fan-in must be at least 2")
+	}
+
+	s := &sorter{
+		ctx:   ctx,
+		cfg:   cfg,
+		arena: make([]byte, 0, cfg.MemoryBudget),
+	}
+	defer func() {
+		if s.tmpdir != "" {
+			if rerr := os.RemoveAll(s.tmpdir); err == nil {
+				err = rerr
+			}
+		}
+	}()
+
+	if err := s.readRuns(r); err != nil {
+		return err
+	}
+
+	out := newOutput(w, cfg)
+
+	// everything fit in memory, no need to go through disk
+	if len(s.runs) == 0 {
+		s.sortArena()
+		for i, sp := range s.spans {
+			if i%checkEvery == 0 {
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+			}
+			if err := out.add(s.arena[sp.off : sp.off+sp.length]); err != nil {
+				return err
+			}
+		}
+		return out.close()
+	}
+
+	if len(s.spans) > 0 {
+		if err := s.spill(); err != nil {
+			return err
+		}
+	}
+	s.arena, s.spans = nil, nil
+
+	for len(s.runs) > s.cfg.MaxFanIn {
+		if err := s.mergePass(); err != nil {
+			return err
+		}
+	}
+	if err := s.merge(s.runs, out.add); err != nil {
+		return err
+	}
+	return out.close()
+}
+
+func (s *sorter) readRuns(r io.Reader) error {
+	lr := linereader.New(r, s.cfg.BlockSize)
+	line := make([]byte, s.cfg.MaxLineSize)
+
+	for i := 0; ; i++ {
+		if i%checkEvery == 0 {
+			if err := s.ctx.Err(); err != nil {
+				return err
+			}
+		}
+
+		n, err := lr.Read(line)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if len(s.arena)+n > s.cfg.MemoryBudget && len(s.spans) > 0 {
+			if err := s.spill(); err != nil {
+				return err
+			}
+		}
+		s.spans = append(s.spans, span{off: len(s.arena), length: n})
+		s.arena = append(s.arena, line[:n]...)
+	}
+}
+
+func (s *sorter) sortArena() {
+	slices.SortStableFunc(s.spans, func(a, b span) int {
+		return s.cfg.Compare(s.arena[a.off:a.off+a.length], s.arena[b.off:b.off+b.length])
+	})
+}
+
+// spill sorts the lines held in memory and writes them to a new run file.
+func (s *sorter) spill() (err error) {
+	if s.tmpdir == "" {
+		if s.tmpdir, err = os.MkdirTemp(s.cfg.TempDir, "extsort-"); err != nil {
+			return err
+		}
+	}
+
+	s.sortArena()
+
+	run, err := s.writeRun(func(add func(line []byte) error) error {
+		for i, sp := range s.spans {
+			if i%checkEvery == 0 {
+				if err := s.ctx.Err(); err != nil {
+					return err
+				}
+			}
+			if err := add(s.arena[sp.off : sp.off+sp.length]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	s.runs = append(s.runs, run)
+
+	s.arena = s.arena[:0]
+	s.spans = s.spans[:0]
+	return nil
+}
+
+// writeRun creates a run file in the temporary directory, and fills it with
+// the lines passed to add by fill.
+func (s *sorter) writeRun(fill func(add func(line []byte) error) error) (run string, err error) {
+	f, err := os.CreateTemp(s.tmpdir, "run-")
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	}()
+
+	bw := bufio.NewWriterSize(f, int(s.cfg.BlockSize))
+	err = fill(func(line []byte) error {
+		bw.Write(line)
+		return bw.WriteByte('\n')
+	})
+	if err != nil {
+		return f.Name(), err
+	}
+	return f.Name(), bw.Flush()
+}
+
+// output writes sorted lines, applying the uniq mode.
+type output struct {
+	bw      *bufio.Writer
+	compare func(a, b []byte) int
+	uniq    UniqMode
+
+	prev    []byte
+	hasPrev bool
+	count   uint64
+}
+
+func newOutput(w io.Writer, cfg Config) *output {
+	return &output{
+		bw:      bufio.NewWriterSize(w, int(cfg.BlockSize)),
+		compare: cfg.Compare,
+		uniq:    cfg.Uniq,
+	}
+}
+
+func (o *output) add(line []byte) error {
+	if o.uniq == UNIQ_MODE_NONE {
+		o.bw.Write(line)
+		return o.bw.WriteByte('\n')
+	}
+
+	if o.hasPrev && o.compare(o.prev, line) == 0 {
+		o.count++
+		return nil
+	}
+	if err := o.emit(); err != nil {
+		return err
+	}
+	o.prev = append(o.prev[:0], line...)
+	o.hasPrev = true
+	o.count = 1
+	return nil
+}
+
+func (o *output) emit() error {
+	if !o.hasPrev {
+		return nil
+	}
+	if o.uniq == UNIQ_MODE_COUNT {
+		fmt.Fprintf(o.bw, "%7d ", o.count)
+	}
+	o.bw.Write(o.prev)
+	return o.bw.WriteByte('\n')
+}
+
+func (o *output) close() error {
+	if err := o.emit(); err != nil {
+		return err
+	}
+	return o.bw.Flush()
+}
@@ -0,0 +1,209 @@
+package extsort_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/asymmetric-research/go-commons/io/extsort"
+	"github.com/asymmetric-research/go-commons/io/linereader"
+	"github.com/stretchr/testify/require"
+)
+
+func randomLines(n int) []string {
+	rng := rand.New(rand.NewPCG(1, 2))
+	lines := make([]string, n)
+	for i := range lines {
+		lines[i] = fmt.Sprintf("crash-%03d", rng.IntN(n/4))
+	}
+	return lines
+}
+
+func config(t *testing.T, budget int) extsort.Config {
+	return extsort.Config{
+		MemoryBudget: budget,
+		MaxLineSize:  256,
+		BlockSize:    256,
+		TempDir:      t.TempDir(),
+	}
+}
+
+func sortLines(t *testing.T, lines []string, cfg extsort.Config) string {
+	var out bytes.Buffer
+	err := extsort.Sort(context.Background(), strings.NewReader(strings.Join(lines, "\n")), &out, cfg)
+	require.NoError(t, err)
+
+	entries, err := os.ReadDir(cfg.TempDir)
+	require.NoError(t, err)
+	require.Empty(t, entries, "temporary files should be removed")
+	return out.String()
+}
+
+func TestSort(t *testing.T) {
+	lines := randomLines(2000)
+	expected := slices.Clone(lines)
+	slices.Sort(expected)
+
+	// in memory, and spilling many runs
+	for _, budget := range []int{1 << 20, 100} {
+		require.Equal(t, strings.Join(expected, "\n")+"\n", sortLines(t, lines, config(t, budget)))
+	}
+
+	// too many runs to merge at once
+	for _, fanIn := range []int{2, 3, 64} {
+		cfg := config(t, 100)
+		cfg.MaxFanIn = fanIn
+		require.Equal(t, strings.Join(expected, "\n")+"\n", sortLines(t, lines, cfg), "fan-in %d", fanIn)
+	}
+}
+
+func TestSortUniq(t *testing.T) {
+	lines := randomLines(2000)
+
+	counts := map[string]int{}
+	for _, line := range lines {
+		counts[line]++
+	}
+	uniq := make([]string, 0, len(counts))
+	for line := range counts {
+		uniq = append(uniq, line)
+	}
+	slices.Sort(uniq)
+
+	var expectedCounts strings.Builder
+	for _, line := range uniq {
+		fmt.Fprintf(&expectedCounts, "%7d %s\n", counts[line], line)
+	}
+
+	for _, budget := range []int{1 << 20, 100} {
+		cfg := config(t, budget)
+		cfg.Uniq = extsort.UNIQ_MODE_UNIQ
+		require.Equal(t, strings.Join(uniq, "\n")+"\n", sortLines(t, lines, cfg))
+
+		cfg.Uniq = extsort.UNIQ_MODE_COUNT
+		require.Equal(t, expectedCounts.String(), sortLines(t, lines, cfg))
+	}
+}
+
+func TestSortCompare(t *testing.T) {
+	lines := []string{"b", "A", "a", "c", "B"}
+	cfg := config(t, 4)
+	cfg.Compare = func(a, b []byte) int {
+		return -bytes.Compare(bytes.ToLower(a), bytes.ToLower(b))
+	}
+	// stable: equal lines keep their input order
+	require.Equal(t, "c\nb\nB\nA\na\n", sortLines(t, lines, cfg))
+	cfg.MaxFanIn = 2
+	require.Equal(t, "c\nb\nB\nA\na\n", sortLines(t, lines, cfg))
+	cfg.MaxFanIn = 0
+
+	cfg.Uniq = extsort.UNIQ_MODE_UNIQ
+	require.Equal(t, "c\nb\nA\n", sortLines(t, lines, cfg))
+}
+
+func TestSortErrors(t *testing.T) {
+	cfg := config(t, 100)
+	cfg.MaxLineSize = 8
+
+	input := strings.Join(randomLines(100), "\n") + "\nthis line is too long\n"
+	err := extsort.Sort(context.Background(), strings.NewReader(input), &bytes.Buffer{}, cfg)
+	var truncated *linereader.ErrLineTruncated
+	require.ErrorAs(t, err, &truncated)
+
+	entries, err := os.ReadDir(cfg.TempDir)
+	require.NoError(t, err)
+	require.Empty(t, entries)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = extsort.Sort(ctx, strings.NewReader(input), &bytes.Buffer{}, config(t, 100))
+	require.ErrorIs(t, err, context.Canceled)
+
+	err = extsort.Sort(context.Background(), strings.NewReader(input), &bytes.Buffer{}, extsort.Config{})
+	require.Error(t, err)
+	cfg = config(t, 100)
+	cfg.MaxFanIn = 1
+	err = extsort.Sort(context.Background(), strings.NewReader(input), &bytes.Buffer{}, cfg)
+	require.Error(t, err)
+}
+
+// hookReader calls hook when r is exhausted, and fails with its error.
+type hookReader struct {
+	r    io.Reader
+	hook func() error
+}
+
+func (h *hookReader) Read(p []byte) (int, error) {
+	n, err := h.r.Read(p)
+	if err == io.EOF {
+		if herr := h.hook(); herr != nil {
+			return n, herr
+		}
+	}
+	return n, err
+}
+
+// countRuns returns the number of run files spilled in dir.
+func countRuns(t *testing.T, dir string) int {
+	runs := 0
+	require.NoError(t, filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			runs++
+		}
+		return err
+	}))
+	return runs
+}
+
+func TestSortErrorsAfterSpill(t *testing.T) {
+	input := strings.Join(randomLines(3000), "\n")
+	errBroken := errors.New("broken")
+
+	for name, tc := range map[string]struct {
+		fail     func(cancel context.CancelFunc) error
+		expected error
+	}{
+		"read error": {
+			fail:     func(context.CancelFunc) error { return errBroken },
+			expected: errBroken,
+		},
+		"cancelled": {
+			fail: func(cancel context.CancelFunc) error {
+				cancel()
+				return nil
+			},
+			expected: context.Canceled,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			for _, fanIn := range []int{2, 64} {
+				ctx, cancel := context.WithCancel(context.Background())
+				defer cancel()
+				cfg := config(t, 100)
+				cfg.MaxFanIn = fanIn
+
+				spilled := 0
+				r := &hookReader{r: strings.NewReader(input), hook: func() error {
+					spilled = countRuns(t, cfg.TempDir)
+					return tc.fail(cancel)
+				}}
+				err := extsort.Sort(ctx, r, &bytes.Buffer{}, cfg)
+				require.ErrorIs(t, err, tc.expected)
+				require.GreaterOrEqual(t, spilled, 2)
+
+				entries, err := os.ReadDir(cfg.TempDir)
+				require.NoError(t, err)
+				require.Empty(t, entries)
+			}
+		})
+	}
+}
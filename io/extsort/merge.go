@@ -0,0 +1,129 @@
+package extsort
+
+import (
+	"container/heap"
+	"io"
+	"os"
+
+	"github.com/asymmetric-research/go-commons/io/linereader"
+)
+
+// cursor is the current line of a run being merged
+type cursor struct {
+	run  int
+	lr   linereader.T
+	buf  []byte
+	line []byte
+}
+
+func (c *cursor) next() (bool, error) {
+	n, err := c.lr.Read(c.buf)
+	if err == io.EOF {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	c.line = c.buf[:n]
+	return true, nil
+}
+
+// cursorHeap orders cursors by their current line. Ties are broken by run
+// index so that the merge is stable.
+type cursorHeap struct {
+	cursors []*cursor
+	compare func(a, b []byte) int
+}
+
+func (h *cursorHeap) Len() int { return len(h.cursors) }
+func (h *cursorHeap) Less(i, j int) bool {
+	a, b := h.cursors[i], h.cursors[j]
+	if c := h.compare(a.line, b.line); c != 0 {
+		return c < 0
+	}
+	return a.run < b.run
+}
+func (h *cursorHeap) Swap(i, j int) { h.cursors[i], h.cursors[j] = h.cursors[j], h.cursors[i] }
+func (h *cursorHeap) Push(x any)    { h.cursors = append(h.cursors, x.(*cursor)) }
+func (h *cursorHeap) Pop() any {
+	last := h.cursors[len(h.cursors)-1]
+	h.cursors = h.cursors[:len(h.cursors)-1]
+	return last
+}
+
+// mergePass merges consecutive groups of up to MaxFanIn runs into one run
+// each, and removes the merged runs. Keeping the groups in order keeps the
+// merge stable.
+func (s *sorter) mergePass() error {
+	var merged []string
+	for start := 0; start < len(s.runs); start += s.cfg.MaxFanIn {
+		group := s.runs[start:min(start+s.cfg.MaxFanIn, len(s.runs))]
+		if len(group) == 1 {
+			merged = append(merged, group[0])
+			continue
+		}
+
+		run, err := s.writeRun(func(add func(line []byte) error) error {
+			return s.merge(group, add)
+		})
+		if err != nil {
+			return err
+		}
+		merged = append(merged, run)
+		for _, r := range group {
+			if err := os.Remove(r); err != nil {
+				return err
+			}
+		}
+	}
+	s.runs = merged
+	return nil
+}
+
+// merge k-way merges runs, passing every line to add in order.
+func (s *sorter) merge(runs []string, add func(line []byte) error) error {
+	h := &cursorHeap{compare: s.cfg.Compare}
+
+	for i, run := range runs {
+		f, err := os.Open(run)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		c := &cursor{run: i, buf: make([]byte, s.cfg.MaxLineSize)}
+		linereader.NewInto(&c.lr, f, s.cfg.BlockSize)
+		ok, err := c.next()
+		if err != nil {
+			return err
+		}
+		if ok {
+			h.cursors = append(h.cursors, c)
+		}
+	}
+	heap.Init(h)
+
+	for i := 0; h.Len() > 0; i++ {
+		if i%checkEvery == 0 {
+			if err := s.ctx.Err(); err != nil {
+				return err
+			}
+		}
+
+		c := h.cursors[0]
+		if err := add(c.line); err != nil {
+			return err
+		}
+
+		ok, err := c.next()
+		if err != nil {
+			return err
+		}
+		if ok {
+			heap.Fix(h, 0)
+		} else {
+			heap.Pop(h)
+		}
+	}
+	return nil
+}
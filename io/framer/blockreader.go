@@ -0,0 +1,103 @@
+package framer
+
+import (
+	"io"
+
+	armath "github.com/asymmetric-research/go-commons/math"
+)
+
+// blockreader buffers reads from the underlying reader in blocks, the same
+// way linereader.T does, so that small headers don't cost a syscall each.
+type blockreader struct {
+	reader      io.Reader
+	readbufbase []byte
+	readbuf     []byte
+	readerErr   error
+}
+
+func newBlockreaderInto(dst *blockreader, reader io.Reader, blockSize uint) {
+	*dst = blockreader{
+		reader:      reader,
+		readbufbase: make([]byte, blockSize),
+	}
+}
+
+// fill refills the read buffer if it is empty. It returns the reader error
+// once the buffer is empty and the reader is done.
+func (br *blockreader) fill() error {
+	for len(br.readbuf) == 0 {
+		if br.readerErr != nil {
+			return br.readerErr
+		}
+		var n int
+		n, br.readerErr = br.reader.Read(br.readbufbase)
+		br.readbuf = br.readbufbase[:n]
+	}
+	return nil
+}
+
+func (br *blockreader) ReadByte() (byte, error) {
+	if err := br.fill(); err != nil {
+		return 0, err
+	}
+	b := br.readbuf[0]
+	br.readbuf = br.readbuf[1:]
+	return b, nil
+}
+
+// readFull fills dst entirely. Reads large enough to bypass the block buffer
+// go straight into dst.
+func (br *blockreader) readFull(dst []byte) (n int, err error) {
+	for n < len(dst) {
+		if len(br.readbuf) == 0 && br.readerErr == nil && len(dst)-n >= len(br.readbufbase) {
+			var rn int
+			rn, br.readerErr = br.reader.Read(dst[n:])
+			n += rn
+			continue
+		}
+		if err := br.fill(); err != nil {
+			return n, err
+		}
+		cpyn := copy(dst[n:], br.readbuf)
+		br.readbuf = br.readbuf[cpyn:]
+		n += cpyn
+	}
+	return n, nil
+}
+
+// discard skips over n bytes.
+func (br *blockreader) discard(n uint64) (uint64, error) {
+	discarded := uint64(0)
+	for discarded < n {
+		if err := br.fill(); err != nil {
+			return discarded, err
+		}
+		skip := armath.Min(uint64(len(br.readbuf)), n-discarded)
+		br.readbuf = br.readbuf[skip:]
+		discarded += skip
+	}
+	return discarded, nil
+}
+
+// readPayload reads a frame of size bytes into dst, discarding what does not
+// fit. Running out of data in the middle of a frame is an io.ErrUnexpectedEOF.
+func (br *blockreader) readPayload(dst []byte, size uint64) (nread int, ndiscarded int, err error) {
+	want := int(armath.Min(size, uint64(len(dst))))
+	nread, err = br.readFull(dst[:want])
+	if err != nil {
+		return nread, 0, unexpectedEOF(err)
+	}
+
+	discarded, err := br.discard(size - uint64(want))
+	if err != nil {
+		return nread, int(discarded), unexpectedEOF(err)
+	}
+	return nread, int(discarded), nil
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,19 @@
+package framer
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrMalformed is returned when the framing itself is invalid, for example a
+// netstring without its trailing comma.
+var ErrMalformed = errors.New("malformed frame")
+
+type ErrFrameTooLarge struct {
+	Size uint64
+	Max  uint64
+}
+
+func (e *ErrFrameTooLarge) Error() string {
+	return fmt.Sprintf("frame too large (%d bytes, max %d)", e.Size, e.Max)
+}
@@ -0,0 +1,78 @@
+package framer
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// Fixed reads frames prefixed by their length encoded as a fixed width
+// integer, for example 4-byte big-endian length prefixes.
+type Fixed struct {
+	br           blockreader
+	width        int
+	order        binary.ByteOrder
+	maxFrameSize uint64
+	err          error
+}
+
+// NewFixed creates a framer for width-byte length prefixes in the given byte
+// order. width must be 1, 2, 4 or 8. Frames announcing more than
+// maxFrameSize bytes are rejected with an *ErrFrameTooLarge; zero means no
+// limit.
+func NewFixed(reader io.Reader, blockSize uint, width int, order binary.ByteOrder, maxFrameSize uint64) (*Fixed, error) {
+	f := &Fixed{}
+	return f, NewFixedInto(f, reader, blockSize, width, order, maxFrameSize)
+}
+
+func NewFixedInto(dst *Fixed, reader io.Reader, blockSize uint, width int, order binary.ByteOrder, maxFrameSize uint64) error {
+	switch width {
+	case 1, 2, 4, 8:
+	default:
+		return fmt.Errorf("unsupported length prefix width %d", width)
+	}
+	*dst = Fixed{
+		width:        width,
+		order:        order,
+		maxFrameSize: maxFrameSize,
+	}
+	newBlockreaderInto(&dst.br, reader, blockSize)
+	return nil
+}
+
+func (f *Fixed) Read(dst []byte) (n int, err error) {
+	return ReadFrame(f, dst)
+}
+
+func (f *Fixed) ReadExtra(dst []byte) (nread int, ndiscarded int, err error) {
+	if f.err != nil {
+		return 0, 0, f.err
+	}
+
+	var prefix [8]byte
+	n, err := f.br.readFull(prefix[:f.width])
+	if err != nil {
+		if n != 0 {
+			err = unexpectedEOF(err)
+		}
+		return 0, 0, err
+	}
+
+	var size uint64
+	switch f.width {
+	case 1:
+		size = uint64(prefix[0])
+	case 2:
+		size = uint64(f.order.Uint16(prefix[:]))
+	case 4:
+		size = uint64(f.order.Uint32(prefix[:]))
+	case 8:
+		size = f.order.Uint64(prefix[:])
+	}
+
+	if f.err = checkFrameSize(size, f.maxFrameSize); f.err != nil {
+		return 0, 0, f.err
+	}
+
+	return f.br.readPayload(dst, size)
+}
@@ -0,0 +1,53 @@
+// Package framer splits a byte stream into frames.
+//
+// Every framer shares the semantics of linereader.T.ReadExtra: each call
+// copies at most one frame into dst, the part of a frame that does not fit
+// into dst is discarded and reported, and the next call starts on the next
+// frame. Code written against Framer can therefore swap newline-delimited
+// text for a length-prefixed or netstring stream.
+package framer
+
+import (
+	"io"
+
+	"github.com/asymmetric-research/go-commons/io/linereader"
+)
+
+type Framer interface {
+	io.Reader
+
+	// ReadExtra copies the next frame into dst and reports how many bytes
+	// of that frame did not fit and were discarded.
+	ReadExtra(dst []byte) (nread int, ndiscarded int, err error)
+}
+
+var _ Framer = (*linereader.T)(nil)
+
+// ReadFrame is the Read implementation shared by all framers. A truncated
+// frame is reported as a *linereader.ErrLineTruncated so callers can handle
+// truncation the same way regardless of the framing.
+func ReadFrame(f Framer, dst []byte) (int, error) {
+	n, discarded, err := f.ReadExtra(dst)
+	if discarded != 0 {
+		return n, &linereader.ErrLineTruncated{Discarded: discarded}
+	}
+	return n, err
+}
+
+// Each calls fn with every frame of f until f is exhausted. buf is the read
+// buffer: longer frames are truncated to len(buf) and passed on, and the bytes
+// cut off are added up in ndiscarded. The frame is only valid for the duration
+// of the call to fn.
+func Each(f Framer, buf []byte, fn func(frame []byte)) (ndiscarded int, err error) {
+	for {
+		n, discarded, err := f.ReadExtra(buf)
+		ndiscarded += discarded
+		if err == io.EOF {
+			return ndiscarded, nil
+		}
+		if err != nil {
+			return ndiscarded, err
+		}
+		fn(buf[:n])
+	}
+}
@@ -0,0 +1,182 @@
+package framer_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/asymmetric-research/go-commons/io/framer"
+	"github.com/asymmetric-research/go-commons/io/linereader"
+	"github.com/stretchr/testify/require"
+)
+
+var frames = []string{"hello", "", "a somewhat longer frame", "x"}
+
+func readAll(t *testing.T, f framer.Framer, bufSize int) (out []string, discarded []int, err error) {
+	buf := make([]byte, bufSize)
+	for {
+		n, dis, err := f.ReadExtra(buf)
+		if err != nil {
+			return out, discarded, err
+		}
+		out = append(out, string(buf[:n]))
+		discarded = append(discarded, dis)
+	}
+}
+
+func uvarintStream(frames []string) []byte {
+	var b []byte
+	for _, f := range frames {
+		b = binary.AppendUvarint(b, uint64(len(f)))
+		b = append(b, f...)
+	}
+	return b
+}
+
+func fixedStream(frames []string, order binary.AppendByteOrder) []byte {
+	var b []byte
+	for _, f := range frames {
+		b = order.AppendUint32(b, uint32(len(f)))
+		b = append(b, f...)
+	}
+	return b
+}
+
+func netstringStream(frames []string) []byte {
+	var b bytes.Buffer
+	for _, f := range frames {
+		fmt.Fprintf(&b, "%d:%s,", len(f), f)
+	}
+	return b.Bytes()
+}
+
+func framers(t *testing.T, wrap func(io.Reader) io.Reader) map[string]framer.Framer {
+	be, err := framer.NewFixed(wrap(bytes.NewReader(fixedStream(frames, binary.BigEndian))), 8, 4, binary.BigEndian, 0)
+	require.NoError(t, err)
+	le, err := framer.NewFixed(wrap(bytes.NewReader(fixedStream(frames, binary.LittleEndian))), 8, 4, binary.LittleEndian, 0)
+	require.NoError(t, err)
+
+	return map[string]framer.Framer{
+		"uvarint":   framer.NewUvarint(wrap(bytes.NewReader(uvarintStream(frames))), 8, 0),
+		"fixed-be":  be,
+		"fixed-le":  le,
+		"netstring": framer.NewNetstring(wrap(bytes.NewReader(netstringStream(frames))), 8, 0),
+		"lines":     linereader.New(wrap(strings.NewReader(strings.Join(frames, "\n"))), 8),
+	}
+}
+
+func TestFramers(t *testing.T) {
+	for _, wrap := range []func(io.Reader) io.Reader{
+		func(r io.Reader) io.Reader { return r },
+		iotest.OneByteReader,
+		iotest.DataErrReader,
+	} {
+		for name, f := range framers(t, wrap) {
+			out, discarded, err := readAll(t, f, 64)
+			require.ErrorIs(t, err, io.EOF, name)
+			require.Equal(t, frames, out, name)
+			require.Equal(t, []int{0, 0, 0, 0}, discarded, name)
+		}
+	}
+}
+
+func TestFramersTruncate(t *testing.T) {
+	for name, f := range framers(t, iotest.HalfReader) {
+		out, discarded, err := readAll(t, f, 4)
+		require.ErrorIs(t, err, io.EOF, name)
+		require.Equal(t, []string{"hell", "", "a so", "x"}, out, name)
+		require.Equal(t, []int{1, 0, 19, 0}, discarded, name)
+	}
+}
+
+func TestFramerReadReportsTruncation(t *testing.T) {
+	f := framer.NewUvarint(bytes.NewReader(uvarintStream(frames)), 8, 0)
+	buf := make([]byte, 4)
+
+	n, err := f.Read(buf)
+	require.Equal(t, 4, n)
+	var truncated *linereader.ErrLineTruncated
+	require.ErrorAs(t, err, &truncated)
+	require.Equal(t, 1, truncated.Discarded)
+
+	n, err = f.Read(buf)
+	require.NoError(t, err)
+	require.Zero(t, n)
+}
+
+func TestEach(t *testing.T) {
+	for name, f := range framers(t, func(r io.Reader) io.Reader { return r }) {
+		var got []string
+		discarded, err := framer.Each(f, make([]byte, 5), func(frame []byte) {
+			got = append(got, string(frame))
+		})
+		require.NoError(t, err, name)
+		require.Equal(t, []string{"hello", "", "a som", "x"}, got, name)
+		require.Equal(t, len("ewhat longer frame"), discarded, name)
+	}
+
+	errBroken := errors.New("broken")
+	lr := linereader.New(io.MultiReader(strings.NewReader("a\nb\n"), iotest.ErrReader(errBroken)), 64)
+	var got []string
+	_, err := framer.Each(lr, make([]byte, 64), func(frame []byte) {
+		got = append(got, string(frame))
+	})
+	require.ErrorIs(t, err, errBroken)
+	require.Equal(t, []string{"a", "b"}, got)
+}
+
+func TestFrameTooLarge(t *testing.T) {
+	f := framer.NewUvarint(bytes.NewReader(uvarintStream(frames)), 8, 10)
+	buf := make([]byte, 64)
+
+	_, _, err := f.ReadExtra(buf)
+	require.NoError(t, err)
+	_, _, err = f.ReadExtra(buf)
+	require.NoError(t, err)
+
+	_, _, err = f.ReadExtra(buf)
+	var tooLarge *framer.ErrFrameTooLarge
+	require.ErrorAs(t, err, &tooLarge)
+	require.Equal(t, uint64(23), tooLarge.Size)
+
+	// the stream position is unknown, the error sticks
+	_, _, err = f.ReadExtra(buf)
+	require.ErrorAs(t, err, &tooLarge)
+}
+
+func TestFramerUnexpectedEOF(t *testing.T) {
+	stream := uvarintStream(frames)
+	f := framer.NewUvarint(bytes.NewReader(stream[:len(stream)-1]), 8, 0)
+	out, _, err := readAll(t, f, 64)
+	require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	require.Equal(t, frames[:3], out)
+
+	fixed, err := framer.NewFixed(bytes.NewReader([]byte{0, 0}), 8, 4, binary.BigEndian, 0)
+	require.NoError(t, err)
+	_, _, err = fixed.ReadExtra(make([]byte, 8))
+	require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+}
+
+func TestNetstringMalformed(t *testing.T) {
+	for _, in := range []string{"5:hello;", "05:hello,", "x:", ":hello,"} {
+		f := framer.NewNetstring(strings.NewReader(in), 8, 0)
+		_, _, err := f.ReadExtra(make([]byte, 64))
+		require.ErrorIs(t, err, framer.ErrMalformed, in)
+	}
+}
+
+func TestFixedWidth(t *testing.T) {
+	_, err := framer.NewFixed(strings.NewReader(""), 8, 3, binary.BigEndian, 0)
+	require.Error(t, err)
+
+	f, err := framer.NewFixed(bytes.NewReader([]byte{0, 2, 'h', 'i', 0, 0}), 8, 2, binary.BigEndian, 0)
+	require.NoError(t, err)
+	out, _, err := readAll(t, f, 8)
+	require.ErrorIs(t, err, io.EOF)
+	require.Equal(t, []string{"hi", ""}, out)
+}
@@ -0,0 +1,96 @@
+package framer
+
+import (
+	"fmt"
+	"io"
+)
+
+// maxNetstringDigits bounds the length prefix so a corrupt stream can't make
+// us parse digits forever. Any 19 digit number fits in a uint64.
+const maxNetstringDigits = 19
+
+// Netstring reads frames encoded as netstrings: "<decimal length>:<payload>,".
+type Netstring struct {
+	br           blockreader
+	maxFrameSize uint64
+	err          error
+}
+
+// NewNetstring creates a netstring framer. Frames announcing more than
+// maxFrameSize bytes are rejected with an *ErrFrameTooLarge; zero means no
+// limit.
+func NewNetstring(reader io.Reader, blockSize uint, maxFrameSize uint64) *Netstring {
+	f := &Netstring{}
+	NewNetstringInto(f, reader, blockSize, maxFrameSize)
+	return f
+}
+
+func NewNetstringInto(dst *Netstring, reader io.Reader, blockSize uint, maxFrameSize uint64) {
+	*dst = Netstring{maxFrameSize: maxFrameSize}
+	newBlockreaderInto(&dst.br, reader, blockSize)
+}
+
+func (f *Netstring) Read(dst []byte) (n int, err error) {
+	return ReadFrame(f, dst)
+}
+
+func (f *Netstring) ReadExtra(dst []byte) (nread int, ndiscarded int, err error) {
+	if f.err != nil {
+		return 0, 0, f.err
+	}
+
+	size, err := f.readLength()
+	if err != nil {
+		if err != io.EOF {
+			f.err = err
+		}
+		return 0, 0, err
+	}
+
+	if f.err = checkFrameSize(size, f.maxFrameSize); f.err != nil {
+		return 0, 0, f.err
+	}
+
+	nread, ndiscarded, err = f.br.readPayload(dst, size)
+	if err != nil {
+		return nread, ndiscarded, err
+	}
+
+	c, err := f.br.ReadByte()
+	if err != nil {
+		return nread, ndiscarded, unexpectedEOF(err)
+	}
+	if c != ',' {
+		f.err = fmt.Errorf("%w: expected ',' after netstring payload, got %q", ErrMalformed, c)
+		return nread, ndiscarded, f.err
+	}
+	return nread, ndiscarded, nil
+}
+
+func (f *Netstring) readLength() (uint64, error) {
+	size := uint64(0)
+	for ndigits := 0; ; ndigits++ {
+		c, err := f.br.ReadByte()
+		if err != nil {
+			if ndigits != 0 {
+				err = unexpectedEOF(err)
+			}
+			return 0, err
+		}
+
+		if c == ':' && ndigits > 0 {
+			return size, nil
+		}
+		if c < '0' || c > '9' {
+			return 0, fmt.Errorf("%w: unexpected %q in netstring length", ErrMalformed, c)
+		}
+		// leading zeros are not allowed, except for the length "0" itself
+		if ndigits == 1 && size == 0 {
+			return 0, fmt.Errorf("%w: leading zero in netstring length", ErrMalformed)
+		}
+		if ndigits == maxNetstringDigits {
+			return 0, fmt.Errorf("%w: netstring length too long", ErrMalformed)
+		}
+		size = size*10 + uint64(c-'0')
+	}
+}
@@ -0,0 +1,62 @@
+package framer
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+)
+
+// Uvarint reads frames prefixed by their length encoded as an unsigned
+// varint, as used by delimited protobuf streams.
+type Uvarint struct {
+	br           blockreader
+	maxFrameSize uint64
+	err          error
+}
+
+// NewUvarint creates a uvarint framer. Frames announcing more than
+// maxFrameSize bytes are rejected with an *ErrFrameTooLarge; zero means no
+// limit.
+func NewUvarint(reader io.Reader, blockSize uint, maxFrameSize uint64) *Uvarint {
+	f := &Uvarint{}
+	NewUvarintInto(f, reader, blockSize, maxFrameSize)
+	return f
+}
+
+func NewUvarintInto(dst *Uvarint, reader io.Reader, blockSize uint, maxFrameSize uint64) {
+	*dst = Uvarint{maxFrameSize: maxFrameSize}
+	newBlockreaderInto(&dst.br, reader, blockSize)
+}
+
+func (f *Uvarint) Read(dst []byte) (n int, err error) {
+	return ReadFrame(f, dst)
+}
+
+func (f *Uvarint) ReadExtra(dst []byte) (nread int, ndiscarded int, err error) {
+	if f.err != nil {
+		return 0, 0, f.err
+	}
+
+	size, err := binary.ReadUvarint(&f.br)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if f.err = checkFrameSize(size, f.maxFrameSize); f.err != nil {
+		return 0, 0, f.err
+	}
+
+	return f.br.readPayload(dst, size)
+}
+
+// checkFrameSize validates a decoded frame length. A frame that is too large
+// leaves the stream in an unknown position, so callers keep the error sticky.
+func checkFrameSize(size, maxFrameSize uint64) error {
+	if maxFrameSize != 0 && size > maxFrameSize {
+		return &ErrFrameTooLarge{Size: size, Max: maxFrameSize}
+	}
+	if size > math.MaxInt {
+		return &ErrFrameTooLarge{Size: size, Max: math.MaxInt}
+	}
+	return nil
+}
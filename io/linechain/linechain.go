@@ -0,0 +1,207 @@
+// Package linechain reads the lines of several sources, such as rotated log
+// files, as one stream while keeping track of where each line came from.
+package linechain
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/asymmetric-research/go-commons/io/linereader"
+)
+
+type Source struct {
+	Name string
+	Open func() (io.ReadCloser, error)
+}
+
+// FileSource opens the file at path when it is reached.
+func FileSource(path string) Source {
+	return Source{
+		Name: path,
+		Open: func() (io.ReadCloser, error) {
+			return os.Open(path)
+		},
+	}
+}
+
+// ReaderSource reads from an already open reader.
+func ReaderSource(name string, r io.Reader) Source {
+	return Source{
+		Name: name,
+		Open: func() (io.ReadCloser, error) {
+			return io.NopCloser(r), nil
+		},
+	}
+}
+
+type Order int
+
+const (
+	// ORDER_NAME orders files lexicographically by path, so app.log.10 comes
+	// before app.log.2. Use ORDER_MTIME for numbered rotations.
+	ORDER_NAME Order = iota
+	// ORDER_MTIME orders files from the least to the most recently modified,
+	// which for rotated logs is from the oldest to the newest lines.
+	ORDER_MTIME
+)
+
+// Glob returns a source for every file matching pattern, in the given order.
+func Glob(pattern string, order Order) ([]Source, error) {
+	paths, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	type file struct {
+		path string
+		info os.FileInfo
+	}
+	files := make([]file, 0, len(paths))
+	for _, p := range paths {
+		info, err := os.Stat(p)
+		if err != nil {
+			return nil, err
+		}
+		if info.IsDir() {
+			continue
+		}
+		files = append(files, file{path: p, info: info})
+	}
+
+	slices.SortFunc(files, func(a, b file) int {
+		if order == ORDER_MTIME {
+			if c := a.info.ModTime().Compare(b.info.ModTime()); c != 0 {
+				return c
+			}
+		}
+		return strings.Compare(a.path, b.path)
+	})
+
+	sources := make([]Source, len(files))
+	for i, f := range files {
+		sources[i] = FileSource(f.path)
+	}
+	return sources, nil
+}
+
+// T reads the lines of its sources one after the other. Every source gets its
+// own linereader.T, so the last line of a source without a trailing newline
+// is never joined with the first line of the next one.
+type T struct {
+	sources   []Source
+	blockSize uint
+	opts      []linereader.Option
+
+	next   int
+	cur    io.ReadCloser
+	curIdx int
+	lr     linereader.T
+	lineNo uint64
+}
+
+func New(sources []Source, blockSize uint, opts ...linereader.Option) *T {
+	t := &T{}
+	NewInto(t, sources, blockSize, opts...)
+	return t
+}
+
+func NewInto(dst *T, sources []Source, blockSize uint, opts ...linereader.Option) {
+	*dst = T{
+		sources:   sources,
+		blockSize: blockSize,
+		opts:      opts,
+		curIdx:    -1,
+	}
+}
+
+func (t *T) Read(dst []byte) (n int, err error) {
+	n, discarded, err := t.ReadExtra(dst)
+	if discarded != 0 {
+		return n, &linereader.ErrLineTruncated{Discarded: discarded}
+	}
+	return n, err
+}
+
+// ReadExtra reads the next line like linereader.T.ReadExtra, moving on to the
+// next source when the current one is exhausted. It returns io.EOF after the
+// last source. If a source fails to open or read, the error is returned along
+// with the part of the line read before it, and the next call moves on to the
+// following source.
+func (t *T) ReadExtra(dst []byte) (nread int, ndiscarded int, err error) {
+	for {
+		if t.cur == nil {
+			if t.next >= len(t.sources) {
+				return 0, 0, io.EOF
+			}
+			if err := t.open(); err != nil {
+				return 0, 0, err
+			}
+		}
+
+		nread, ndiscarded, err = t.lr.ReadExtra(dst)
+		if err == nil {
+			t.lineNo++
+			return
+		}
+
+		cerr := t.closeCurrent()
+		if err != io.EOF {
+			if nread > 0 || ndiscarded > 0 {
+				t.lineNo++
+			}
+			return nread, ndiscarded, fmt.Errorf("%s: %w", t.sources[t.curIdx].Name, err)
+		}
+		if cerr != nil {
+			return 0, 0, fmt.Errorf("%s: %w", t.sources[t.curIdx].Name, cerr)
+		}
+	}
+}
+
+func (t *T) open() error {
+	src := t.sources[t.next]
+	t.curIdx = t.next
+	t.next++
+	t.lineNo = 0
+
+	r, err := src.Open()
+	if err != nil {
+		return fmt.Errorf("%s: %w", src.Name, err)
+	}
+	t.cur = r
+	linereader.NewInto(&t.lr, r, t.blockSize, t.opts...)
+	return nil
+}
+
+func (t *T) closeCurrent() error {
+	// stops the read ahead of a source that wasn't read to the end
+	t.lr.Close()
+	err := t.cur.Close()
+	t.cur = nil
+	return err
+}
+
+// Source returns the name of the source of the last line read.
+func (t *T) Source() string {
+	if t.curIdx < 0 {
+		return ""
+	}
+	return t.sources[t.curIdx].Name
+}
+
+// LineNo returns the line number of the last line read within its source,
+// starting at 1.
+func (t *T) LineNo() uint64 {
+	return t.lineNo
+}
+
+// Close closes the source being read, if any.
+func (t *T) Close() error {
+	if t.cur == nil {
+		return nil
+	}
+	return t.closeCurrent()
+}
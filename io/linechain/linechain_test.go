@@ -0,0 +1,152 @@
+package linechain_test
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/asymmetric-research/go-commons/io/linechain"
+	"github.com/asymmetric-research/go-commons/io/linereader"
+	"github.com/stretchr/testify/require"
+)
+
+type line struct {
+	text   string
+	source string
+	lineNo uint64
+}
+
+func readAll(t *testing.T, c *linechain.T) ([]line, error) {
+	var out []line
+	buf := make([]byte, 64)
+	for {
+		n, _, err := c.ReadExtra(buf)
+		if err == io.EOF {
+			return out, nil
+		}
+		if err != nil {
+			return out, err
+		}
+		out = append(out, line{string(buf[:n]), c.Source(), c.LineNo()})
+	}
+}
+
+func TestChain(t *testing.T) {
+	c := linechain.New([]linechain.Source{
+		linechain.ReaderSource("a", strings.NewReader("a1\na2")),
+		linechain.ReaderSource("empty", strings.NewReader("")),
+		linechain.ReaderSource("b", strings.NewReader("b1\nb2\n")),
+	}, 64)
+
+	lines, err := readAll(t, c)
+	require.NoError(t, err)
+	require.Equal(t, []line{
+		{"a1", "a", 1},
+		{"a2", "a", 2},
+		{"b1", "b", 1},
+		{"b2", "b", 2},
+	}, lines)
+	require.NoError(t, c.Close())
+}
+
+func TestChainOpenError(t *testing.T) {
+	errOpen := errors.New("cannot open")
+	c := linechain.New([]linechain.Source{
+		{Name: "broken", Open: func() (io.ReadCloser, error) { return nil, errOpen }},
+		linechain.ReaderSource("ok", strings.NewReader("line")),
+	}, 64)
+
+	_, err := readAll(t, c)
+	require.ErrorIs(t, err, errOpen)
+	require.ErrorContains(t, err, "broken")
+
+	lines, err := readAll(t, c)
+	require.NoError(t, err)
+	require.Equal(t, []line{{"line", "ok", 1}}, lines)
+}
+
+func TestChainReadError(t *testing.T) {
+	errRead := errors.New("cannot read")
+	c := linechain.New([]linechain.Source{
+		linechain.ReaderSource("broken", io.MultiReader(strings.NewReader("a1\npart"), iotest.ErrReader(errRead))),
+		linechain.ReaderSource("ok", strings.NewReader("line")),
+	}, 64)
+
+	var got []string
+	buf := make([]byte, 64)
+	for {
+		n, _, err := c.ReadExtra(buf)
+		if n > 0 {
+			got = append(got, string(buf[:n]))
+		}
+		if err != nil {
+			require.ErrorIs(t, err, errRead)
+			require.ErrorContains(t, err, "broken")
+			break
+		}
+	}
+	require.Equal(t, []string{"a1", "part"}, got)
+	require.Equal(t, uint64(2), c.LineNo())
+
+	lines, err := readAll(t, c)
+	require.NoError(t, err)
+	require.Equal(t, []line{{"line", "ok", 1}}, lines)
+}
+
+func TestChainCloseStopsReadAhead(t *testing.T) {
+	goroutines := runtime.NumGoroutine()
+
+	long := strings.Repeat("line\n", 10000)
+	for range 10 {
+		c := linechain.New([]linechain.Source{
+			linechain.ReaderSource("long", strings.NewReader(long)),
+		}, 16, linereader.WithReadAhead())
+		_, _, err := c.ReadExtra(make([]byte, 64))
+		require.NoError(t, err)
+		require.NoError(t, c.Close())
+	}
+	for deadline := time.Now().Add(time.Second); runtime.NumGoroutine() > goroutines; {
+		require.True(t, time.Now().Before(deadline), "read-ahead goroutines left behind")
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestGlob(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	for i, f := range []struct{ name, content string }{
+		{"app.log.2", "oldest\n"},
+		{"app.log.1", "older"},
+		{"app.log", "newest\n"},
+	} {
+		p := filepath.Join(dir, f.name)
+		require.NoError(t, os.WriteFile(p, []byte(f.content), 0o666))
+		mtime := now.Add(time.Duration(i) * time.Minute)
+		require.NoError(t, os.Chtimes(p, mtime, mtime))
+	}
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "app.log.d"), 0o777))
+
+	sources, err := linechain.Glob(filepath.Join(dir, "app.log*"), linechain.ORDER_MTIME)
+	require.NoError(t, err)
+	lines, err := readAll(t, linechain.New(sources, 64))
+	require.NoError(t, err)
+	require.Equal(t, []line{
+		{"oldest", filepath.Join(dir, "app.log.2"), 1},
+		{"older", filepath.Join(dir, "app.log.1"), 1},
+		{"newest", filepath.Join(dir, "app.log"), 1},
+	}, lines)
+
+	sources, err = linechain.Glob(filepath.Join(dir, "app.log*"), linechain.ORDER_NAME)
+	require.NoError(t, err)
+	names := make([]string, len(sources))
+	for i, s := range sources {
+		names[i] = filepath.Base(s.Name)
+	}
+	require.Equal(t, []string{"app.log", "app.log.1", "app.log.2"}, names)
+}
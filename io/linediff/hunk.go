@@ -0,0 +1,184 @@
+package linediff
+
+import (
+	"fmt"
+	"io"
+)
+
+type hunkLine struct {
+	op         Op
+	start, end int // text offsets
+}
+
+// hunkWriter groups a stream of edits into unified diff hunks. Changes less
+// than 2*context lines apart share a hunk. A hunk is split once it holds
+// opts.Window changed lines, so at most Window+2*Context lines are held.
+type hunkWriter struct {
+	w       io.Writer
+	opts    Options
+	changed bool
+
+	// ring of the last context lines seen while no hunk is open
+	before     [][]byte
+	beforeHead int
+	beforeLen  int
+
+	open         bool
+	astart       int
+	bstart       int
+	lines        []hunkLine
+	text         []byte
+	changes      int
+	trailingSame int
+}
+
+func newHunkWriter(w io.Writer, opts Options) *hunkWriter {
+	return &hunkWriter{w: w, opts: opts, before: make([][]byte, opts.Context)}
+}
+
+func (h *hunkWriter) add(op Op, a, b int, text []byte) error {
+	if op == OP_EQUAL && !h.open {
+		h.addBefore(text)
+		return nil
+	}
+
+	if !h.open {
+		h.start(a-h.beforeLen, b-h.beforeLen)
+		for i := range h.beforeLen {
+			h.push(OP_EQUAL, h.before[(h.beforeHead+i)%len(h.before)])
+		}
+		h.beforeLen = 0
+	}
+
+	h.push(op, text)
+	if op != OP_EQUAL {
+		h.changes++
+		h.trailingSame = 0
+		if h.changes < h.opts.Window {
+			return nil
+		}
+		// write what we have, the rest of the changes go to the next hunk
+		if err := h.flush(); err != nil {
+			return err
+		}
+		if op == OP_DELETE {
+			a++
+		} else {
+			b++
+		}
+		h.start(a, b)
+		return nil
+	}
+
+	h.trailingSame++
+	if h.trailingSame <= 2*h.opts.Context {
+		return nil
+	}
+
+	// the next change is too far away to share this hunk
+	tail := h.lines[len(h.lines)-h.trailingSame+h.opts.Context:]
+	kept := make([]hunkLine, len(tail)-1)
+	copy(kept, tail[1:])
+	h.lines = h.lines[:len(h.lines)-len(tail)]
+	if err := h.flush(); err != nil {
+		return err
+	}
+
+	for _, l := range kept {
+		h.addBefore(h.text[l.start:l.end])
+	}
+	return nil
+}
+
+func (h *hunkWriter) start(a, b int) {
+	h.open = true
+	h.astart = a
+	h.bstart = b
+	h.lines = h.lines[:0]
+	h.text = h.text[:0]
+	h.changes = 0
+	h.trailingSame = 0
+}
+
+func (h *hunkWriter) push(op Op, text []byte) {
+	start := len(h.text)
+	h.text = append(h.text, text...)
+	h.lines = append(h.lines, hunkLine{op: op, start: start, end: len(h.text)})
+}
+
+// addBefore remembers the last context lines before a hunk.
+func (h *hunkWriter) addBefore(text []byte) {
+	if len(h.before) == 0 {
+		return
+	}
+	i := (h.beforeHead + h.beforeLen) % len(h.before)
+	if h.beforeLen == len(h.before) {
+		h.beforeHead = (h.beforeHead + 1) % len(h.before)
+	} else {
+		h.beforeLen++
+	}
+	h.before[i] = append(h.before[i][:0], text...)
+}
+
+// flush writes the open hunk, unless it is left with context lines only after
+// a split.
+func (h *hunkWriter) flush() error {
+	h.open = false
+	h.trailingSame = 0
+	if h.changes == 0 {
+		return nil
+	}
+
+	if !h.changed {
+		h.changed = true
+		if h.opts.NameA != "" || h.opts.NameB != "" {
+			if _, err := fmt.Fprintf(h.w, "--- %s\n+++ %s\n", h.opts.NameA, h.opts.NameB); err != nil {
+				return err
+			}
+		}
+	}
+
+	acount, bcount := 0, 0
+	for _, l := range h.lines {
+		if l.op != OP_INSERT {
+			acount++
+		}
+		if l.op != OP_DELETE {
+			bcount++
+		}
+	}
+	if _, err := fmt.Fprintf(h.w, "@@ -%s +%s @@\n", hunkRange(h.astart, acount), hunkRange(h.bstart, bcount)); err != nil {
+		return err
+	}
+
+	prefixes := [...]byte{OP_EQUAL: ' ', OP_DELETE: '-', OP_INSERT: '+'}
+	for _, l := range h.lines {
+		if _, err := fmt.Fprintf(h.w, "%c%s\n", prefixes[l.op], h.text[l.start:l.end]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hunkRange formats a hunk range the way GNU diff does: the count is omitted
+// when it is 1, and an empty range points at the line before it.
+func hunkRange(start, count int) string {
+	switch count {
+	case 0:
+		return fmt.Sprintf("%d,0", start)
+	case 1:
+		return fmt.Sprintf("%d", start+1)
+	default:
+		return fmt.Sprintf("%d,%d", start+1, count)
+	}
+}
+
+func (h *hunkWriter) close() error {
+	if !h.open {
+		return nil
+	}
+	if h.trailingSame > h.opts.Context {
+		h.lines = h.lines[:len(h.lines)-h.trailingSame+h.opts.Context]
+	}
+	return h.flush()
+}
@@ -0,0 +1,171 @@
+// Package linediff computes line diffs between two streams and writes them as
+// unified diff hunks.
+package linediff
+
+import (
+	"bufio"
+	"fmt"
+	"hash/maphash"
+	"io"
+
+	"github.com/asymmetric-research/go-commons/io/framer"
+)
+
+const defaultWindow = 1 << 14
+
+type Options struct {
+	// Context is the number of unchanged lines shown around changes, diff -u
+	// uses 3.
+	Context int
+	// Window bounds how many lines of each side are held in memory, and how
+	// many changed lines a hunk holds before it is written: longer hunks are
+	// split. Inputs longer than the window are diffed window by window, which
+	// may give a longer diff than a full diff around window boundaries. Zero
+	// uses a window of 16384 lines.
+	Window int
+	// MaxLineSize bounds the length of a line, longer lines are truncated.
+	MaxLineSize int
+	// NameA and NameB are printed in the "---" and "+++" header lines. The
+	// header is omitted if both are empty.
+	NameA string
+	NameB string
+}
+
+// side holds the lines of one input that are not diffed yet, at most a window
+// of them.
+type side struct {
+	src  framer.Framer
+	eof  bool
+	next int // global index of lines[0]
+
+	hashes []uint64
+	// line i is text[offsets[i]:offsets[i+1]], text before offsets[0] belongs
+	// to dropped lines and is reclaimed once it makes up half of text
+	offsets []int
+	text    []byte
+}
+
+func (s *side) len() int {
+	return len(s.hashes)
+}
+
+func (s *side) line(i int) []byte {
+	return s.text[s.offsets[i]:s.offsets[i+1]]
+}
+
+func (s *side) fill(window int, buf []byte, seed maphash.Seed) error {
+	for !s.eof && s.len() < window {
+		n, _, err := s.src.ReadExtra(buf)
+		if err == io.EOF {
+			s.eof = true
+			break
+		}
+		if err != nil {
+			return err
+		}
+		s.hashes = append(s.hashes, maphash.Bytes(seed, buf[:n]))
+		s.text = append(s.text, buf[:n]...)
+		s.offsets = append(s.offsets, len(s.text))
+	}
+	return nil
+}
+
+// drop forgets the first n lines.
+func (s *side) drop(n int) {
+	s.next += n
+	s.hashes = append(s.hashes[:0], s.hashes[n:]...)
+
+	s.offsets = append(s.offsets[:0], s.offsets[n:]...)
+
+	start := s.offsets[0]
+	if start < len(s.text)/2 {
+		return
+	}
+	s.text = append(s.text[:0], s.text[start:]...)
+	for i := range s.offsets {
+		s.offsets[i] -= start
+	}
+}
+
+// Unified diffs a and b and writes the differences to w as unified diff
+// hunks. It reports whether the inputs differ. As lines are read through
+// framers, a missing newline at the end of an input is not reported.
+func Unified(w io.Writer, a, b framer.Framer, opts Options) (differ bool, err error) {
+	if opts.MaxLineSize <= 0 {
+		return false, fmt.Errorf("max line size must be greater than zero")
+	}
+	if opts.Context < 0 {
+		return false, fmt.Errorf("context must not be negative")
+	}
+
+	if opts.Window <= 0 {
+		opts.Window = defaultWindow
+	}
+
+	bw := bufio.NewWriter(w)
+	hw := newHunkWriter(bw, opts)
+
+	seed := maphash.MakeSeed()
+	buf := make([]byte, opts.MaxLineSize)
+	sa := &side{src: a, offsets: []int{0}}
+	sb := &side{src: b, offsets: []int{0}}
+
+	for {
+		if err := sa.fill(opts.Window, buf, seed); err != nil {
+			return hw.changed, err
+		}
+		if err := sb.fill(opts.Window, buf, seed); err != nil {
+			return hw.changed, err
+		}
+
+		edits := Diff(sa.hashes, sb.hashes)
+		done := sa.eof && sb.eof
+
+		// Keep the edits after the last common line for the next window, they
+		// may match lines that aren't read yet.
+		commit := len(edits)
+		if !done {
+			for i := len(edits) - 1; i >= 0; i-- {
+				if edits[i].Op == OP_EQUAL {
+					commit = i + 1
+					break
+				}
+			}
+		}
+
+		for _, e := range edits[:commit] {
+			var text []byte
+			if e.Op == OP_INSERT {
+				text = sb.line(e.B)
+			} else {
+				text = sa.line(e.A)
+			}
+			if err := hw.add(e.Op, sa.next+e.A, sb.next+e.B, text); err != nil {
+				return hw.changed, err
+			}
+		}
+
+		if done {
+			break
+		}
+
+		na, nb := 0, 0
+		if commit > 0 {
+			last := edits[commit-1]
+			na, nb = last.A, last.B
+			if last.Op != OP_INSERT {
+				na++
+			}
+			if last.Op != OP_DELETE {
+				nb++
+			}
+		}
+		sa.drop(na)
+		sb.drop(nb)
+	}
+
+	if err := hw.close(); err != nil {
+		return hw.changed, err
+	}
+	return hw.changed, bw.Flush()
+}
@@ -0,0 +1,244 @@
+package linediff_test
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/asymmetric-research/go-commons/io/linediff"
+	"github.com/asymmetric-research/go-commons/io/linereader"
+	"github.com/stretchr/testify/require"
+)
+
+func lcsLen(a, b []uint64) int {
+	dp := make([][]int, len(a)+1)
+	for i := range dp {
+		dp[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				dp[i][j] = dp[i+1][j+1] + 1
+			} else {
+				dp[i][j] = max(dp[i+1][j], dp[i][j+1])
+			}
+		}
+	}
+	return dp[0][0]
+}
+
+func randomSeq(rng *rand.Rand, n, alphabet int) []uint64 {
+	s := make([]uint64, n)
+	for i := range s {
+		s[i] = uint64(rng.IntN(alphabet))
+	}
+	return s
+}
+
+func TestDiffIsShortest(t *testing.T) {
+	rng := rand.New(rand.NewPCG(1, 1))
+	for range 500 {
+		a := randomSeq(rng, rng.IntN(30), 4)
+		b := randomSeq(rng, rng.IntN(30), 4)
+
+		edits := linediff.Diff(a, b)
+
+		var gotB []uint64
+		equal := 0
+		i, j := 0, 0
+		for _, e := range edits {
+			switch e.Op {
+			case linediff.OP_EQUAL:
+				require.Equal(t, i, e.A)
+				require.Equal(t, j, e.B)
+				require.Equal(t, a[e.A], b[e.B])
+				gotB = append(gotB, a[e.A])
+				equal++
+				i++
+				j++
+			case linediff.OP_DELETE:
+				require.Equal(t, i, e.A)
+				i++
+			case linediff.OP_INSERT:
+				require.Equal(t, j, e.B)
+				gotB = append(gotB, b[e.B])
+				j++
+			}
+		}
+		require.Equal(t, len(a), i)
+		require.Equal(t, len(b), j)
+		require.True(t, slices.Equal(b, gotB), "a=%v b=%v", a, b)
+		require.Equal(t, lcsLen(a, b), equal, "a=%v b=%v", a, b)
+	}
+}
+
+func unified(t *testing.T, a, b string, opts linediff.Options) (string, bool) {
+	var out bytes.Buffer
+	if opts.MaxLineSize == 0 {
+		opts.MaxLineSize = 256
+	}
+	differ, err := linediff.Unified(
+		&out,
+		linereader.New(strings.NewReader(a), 256),
+		linereader.New(strings.NewReader(b), 256),
+		opts,
+	)
+	require.NoError(t, err)
+	return out.String(), differ
+}
+
+func TestUnified(t *testing.T) {
+	a := "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n13\n14\n15\n"
+	b := "1\n2\nthree\n4\n5\n6\n7\n8\n9\n10\n11\n13\n14\n15\nsixteen\n"
+
+	out, differ := unified(t, a, b, linediff.Options{Context: 3, NameA: "a.txt", NameB: "b.txt"})
+	require.True(t, differ)
+	require.Equal(t, `--- a.txt
++++ b.txt
+@@ -1,6 +1,6 @@
+ 1
+ 2
+-3
++three
+ 4
+ 5
+ 6
+@@ -9,7 +9,7 @@
+ 9
+ 10
+ 11
+-12
+ 13
+ 14
+ 15
++sixteen
+`, out)
+
+	out, _ = unified(t, a, b, linediff.Options{Context: 0})
+	require.Equal(t, `@@ -3 +3 @@
+-3
++three
+@@ -12 +11,0 @@
+-12
+@@ -15,0 +15 @@
++sixteen
+`, out)
+
+	// changes 2*context lines apart share a hunk
+	out, _ = unified(t, "a\n1\n2\nb\n", "A\n1\n2\nB\n", linediff.Options{Context: 1})
+	require.Equal(t, "@@ -1,4 +1,4 @@\n-a\n+A\n 1\n 2\n-b\n+B\n", out)
+
+	out, differ = unified(t, a, a, linediff.Options{Context: 3, NameA: "a", NameB: "b"})
+	require.False(t, differ)
+	require.Empty(t, out)
+
+	out, _ = unified(t, "", "x\n", linediff.Options{Context: 3})
+	require.Equal(t, "@@ -0,0 +1 @@\n+x\n", out)
+
+	_, err := linediff.Unified(io.Discard, linereader.New(strings.NewReader(a), 256), linereader.New(strings.NewReader(b), 256), linediff.Options{Context: -1, MaxLineSize: 256})
+	require.Error(t, err)
+}
+
+var hunkHeader = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@$`)
+
+// patch applies a unified diff to a, checking that context and deleted lines
+// match.
+func patch(t *testing.T, a []string, diff string) []string {
+	var out []string
+	ai := 0
+	lines := strings.Split(strings.TrimSuffix(diff, "\n"), "\n")
+	for len(lines) > 0 && lines[0] != "" {
+		m := hunkHeader.FindStringSubmatch(lines[0])
+		require.NotNil(t, m, lines[0])
+		start, _ := strconv.Atoi(m[1])
+		if m[2] != "0" {
+			start--
+		}
+		out = append(out, a[ai:start]...)
+		ai = start
+		lines = lines[1:]
+
+		for len(lines) > 0 && !strings.HasPrefix(lines[0], "@@") {
+			text := lines[0][1:]
+			switch lines[0][0] {
+			case ' ':
+				require.Equal(t, a[ai], text)
+				out = append(out, text)
+				ai++
+			case '-':
+				require.Equal(t, a[ai], text)
+				ai++
+			case '+':
+				out = append(out, text)
+			}
+			lines = lines[1:]
+		}
+	}
+	return append(out, a[ai:]...)
+}
+
+func TestUnifiedWindowed(t *testing.T) {
+	rng := rand.New(rand.NewPCG(3, 4))
+	toLines := func(s []uint64) []string {
+		lines := make([]string, len(s))
+		for i, v := range s {
+			lines[i] = fmt.Sprintf("line %d", v)
+		}
+		return lines
+	}
+
+	for range 200 {
+		a := toLines(randomSeq(rng, rng.IntN(200), 20))
+		b := toLines(randomSeq(rng, rng.IntN(200), 20))
+		for _, window := range []int{0, 1, 7, 50} {
+			for _, context := range []int{0, 3} {
+				out, differ := unified(t, strings.Join(a, "\n"), strings.Join(b, "\n"), linediff.Options{Context: context, Window: window})
+				require.Equal(t, strings.Join(a, "\n") != strings.Join(b, "\n"), differ)
+				require.Equal(t, strings.Join(b, "\n"), strings.Join(patch(t, a, out), "\n"), "window %d", window)
+			}
+		}
+	}
+}
+
+func TestUnifiedBounded(t *testing.T) {
+	// long runs of changes are split into hunks of Window changed lines
+	var a, b []string
+	for i := range 10 {
+		a = append(a, fmt.Sprintf("a%d", i))
+		b = append(b, fmt.Sprintf("b%d", i))
+	}
+	a = append([]string{"same"}, append(a, "same")...)
+	b = append([]string{"same"}, append(b, "same")...)
+	out, _ := unified(t, strings.Join(a, "\n"), strings.Join(b, "\n"), linediff.Options{Context: 1, Window: 3})
+	require.Equal(t, strings.Join(b, "\n"), strings.Join(patch(t, a, out), "\n"))
+	changed := 0
+	for _, line := range strings.Split(strings.TrimSuffix(out, "\n"), "\n") {
+		if strings.HasPrefix(line, "@@") {
+			changed = 0
+			continue
+		}
+		if line[0] != ' ' {
+			changed++
+		}
+		require.LessOrEqual(t, changed, 3, out)
+	}
+
+	// inputs longer than the default window are diffed window by window
+	a, b = nil, nil
+	for i := range 40000 {
+		a = append(a, fmt.Sprintf("line %d", i))
+		if i%10000 != 5 {
+			b = append(b, fmt.Sprintf("line %d", i))
+		}
+	}
+	out, differ := unified(t, strings.Join(a, "\n"), strings.Join(b, "\n"), linediff.Options{Context: 3})
+	require.True(t, differ)
+	require.Equal(t, strings.Join(b, "\n"), strings.Join(patch(t, a, out), "\n"))
+	require.Equal(t, 4, strings.Count(out, "@@ -"))
+}
@@ -0,0 +1,187 @@
+package linediff
+
+type Op int
+
+const (
+	OP_EQUAL Op = iota
+	OP_DELETE
+	OP_INSERT
+)
+
+// Edit is one line of an edit script. A is the index of the line in a for
+// OP_EQUAL and OP_DELETE, B the index of the line in b for OP_EQUAL and
+// OP_INSERT.
+type Edit struct {
+	Op Op
+	A  int
+	B  int
+}
+
+// Diff returns a shortest edit script turning a into b. Lines are compared by
+// hash only, so memory is proportional to the number of lines regardless of
+// their length. It uses the linear space variant of Myers' algorithm.
+func Diff(a, b []uint64) []Edit {
+	d := differ{
+		a:        a,
+		b:        b,
+		deleted:  make([]bool, len(a)),
+		inserted: make([]bool, len(b)),
+	}
+	d.compareseq(0, len(a), 0, len(b))
+
+	edits := make([]Edit, 0, max(len(a), len(b)))
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && d.deleted[i]:
+			edits = append(edits, Edit{Op: OP_DELETE, A: i, B: j})
+			i++
+		case j < len(b) && d.inserted[j]:
+			edits = append(edits, Edit{Op: OP_INSERT, A: i, B: j})
+			j++
+		default:
+			edits = append(edits, Edit{Op: OP_EQUAL, A: i, B: j})
+			i++
+			j++
+		}
+	}
+	return edits
+}
+
+// differ marks the lines deleted from a and inserted in b, like GNU diff's
+// compareseq does.
+type differ struct {
+	a, b     []uint64
+	deleted  []bool
+	inserted []bool
+
+	// forward and backward furthest reaching paths, reused across calls
+	vf, vb []int
+}
+
+func (d *differ) compareseq(xoff, xlim, yoff, ylim int) {
+	// strip the common prefix and suffix
+	for xoff < xlim && yoff < ylim && d.a[xoff] == d.b[yoff] {
+		xoff++
+		yoff++
+	}
+	for xoff < xlim && yoff < ylim && d.a[xlim-1] == d.b[ylim-1] {
+		xlim--
+		ylim--
+	}
+
+	switch {
+	case xoff == xlim:
+		for y := yoff; y < ylim; y++ {
+			d.inserted[y] = true
+		}
+	case yoff == ylim:
+		for x := xoff; x < xlim; x++ {
+			d.deleted[x] = true
+		}
+	default:
+		xmid, ymid, ok := d.midsnake(xoff, xlim, yoff, ylim)
+		if !ok || (xmid == xoff && ymid == yoff) || (xmid == xlim && ymid == ylim) {
+			// nothing in common
+			for x := xoff; x < xlim; x++ {
+				d.deleted[x] = true
+			}
+			for y := yoff; y < ylim; y++ {
+				d.inserted[y] = true
+			}
+			return
+		}
+		d.compareseq(xoff, xmid, yoff, ymid)
+		d.compareseq(xmid, xlim, ymid, ylim)
+	}
+}
+
+// midsnake finds the point where the forward and backward searches for a
+// shortest edit script of a[xoff:xlim] and b[yoff:ylim] overlap.
+func (d *differ) midsnake(xoff, xlim, yoff, ylim int) (xmid, ymid int, ok bool) {
+	a, b := d.a[xoff:xlim], d.b[yoff:ylim]
+	n, m := len(a), len(b)
+
+	maxd := (n + m + 1) / 2
+	voff := maxd
+	vlen := 2*maxd + 2
+	if cap(d.vf) < vlen {
+		d.vf = make([]int, vlen)
+		d.vb = make([]int, vlen)
+	}
+	vf, vb := d.vf[:vlen], d.vb[:vlen]
+	for i := range vf {
+		vf[i] = -1
+		vb[i] = -1
+	}
+	vf[voff+1] = 0
+	vb[voff+1] = 0
+
+	delta := n - m
+	// if the delta is odd the paths overlap in the forward pass
+	front := delta%2 != 0
+
+	kfstart, kfend, kbstart, kbend := 0, 0, 0, 0
+	for step := 0; step < maxd; step++ {
+		for kf := -step + kfstart; kf <= step-kfend; kf += 2 {
+			kfoff := voff + kf
+			var x int
+			if kf == -step || (kf != step && vf[kfoff-1] < vf[kfoff+1]) {
+				x = vf[kfoff+1]
+			} else {
+				x = vf[kfoff-1] + 1
+			}
+			y := x - kf
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			vf[kfoff] = x
+
+			switch {
+			case x > n:
+				kfend += 2
+			case y > m:
+				kfstart += 2
+			case front:
+				kboff := voff + delta - kf
+				if kboff >= 0 && kboff < vlen && vb[kboff] != -1 && x >= n-vb[kboff] {
+					return xoff + x, yoff + y, true
+				}
+			}
+		}
+
+		for kb := -step + kbstart; kb <= step-kbend; kb += 2 {
+			kboff := voff + kb
+			var x int
+			if kb == -step || (kb != step && vb[kboff-1] < vb[kboff+1]) {
+				x = vb[kboff+1]
+			} else {
+				x = vb[kboff-1] + 1
+			}
+			y := x - kb
+			for x < n && y < m && a[n-x-1] == b[m-y-1] {
+				x++
+				y++
+			}
+			vb[kboff] = x
+
+			switch {
+			case x > n:
+				kbend += 2
+			case y > m:
+				kbstart += 2
+			case !front:
+				kfoff := voff + delta - kb
+				if kfoff >= 0 && kfoff < vlen && vf[kfoff] != -1 {
+					xf := vf[kfoff]
+					yf := voff + xf - kfoff
+					if xf >= n-x {
+						return xoff + xf, yoff + yf, true
+					}
+				}
+			}
+		}
+	}
+	return 0, 0, false
+}
@@ -0,0 +1,90 @@
+// Package lineops provides composable operators over line streams. Every
+// operator wraps a framer.Framer and is one itself, so they can be chained:
+//
+//	lineops.Head(lineops.Skip(linereader.New(r, 4096), 1), 100)
+//
+// Lines are counted the way linereader.T produces them: a trailing newline
+// does not start an extra empty line, and a last line without a newline is
+// still a line.
+package lineops
+
+import (
+	"io"
+
+	"github.com/asymmetric-research/go-commons/io/framer"
+)
+
+type skip struct {
+	src     framer.Framer
+	n       uint64
+	skipped uint64
+}
+
+// Skip drops the first n lines of src, such as headers.
+func Skip(src framer.Framer, n uint64) framer.Framer {
+	return &skip{src: src, n: n}
+}
+
+func (s *skip) Read(dst []byte) (int, error) {
+	return framer.ReadFrame(s, dst)
+}
+
+func (s *skip) ReadExtra(dst []byte) (nread int, ndiscarded int, err error) {
+	for s.skipped < s.n {
+		if _, _, err := s.src.ReadExtra(dst); err != nil {
+			return 0, 0, err
+		}
+		s.skipped++
+	}
+	return s.src.ReadExtra(dst)
+}
+
+type head struct {
+	src  framer.Framer
+	n    uint64
+	read uint64
+}
+
+// Head stops after the first n lines of src. src is not read past them.
+func Head(src framer.Framer, n uint64) framer.Framer {
+	return &head{src: src, n: n}
+}
+
+func (h *head) Read(dst []byte) (int, error) {
+	return framer.ReadFrame(h, dst)
+}
+
+func (h *head) ReadExtra(dst []byte) (nread int, ndiscarded int, err error) {
+	if h.read >= h.n {
+		return 0, 0, io.EOF
+	}
+	nread, ndiscarded, err = h.src.ReadExtra(dst)
+	if err == nil {
+		h.read++
+	}
+	return
+}
+
+type every struct {
+	src framer.Framer
+	k   uint64
+}
+
+// Every emits every kth line of src: lines k, 2k, 3k and so on, counting from
+// one like awk's NR % k == 0. A k of zero emits every line, like one.
+func Every(src framer.Framer, k uint64) framer.Framer {
+	return &every{src: src, k: k}
+}
+
+func (e *every) Read(dst []byte) (int, error) {
+	return framer.ReadFrame(e, dst)
+}
+
+func (e *every) ReadExtra(dst []byte) (nread int, ndiscarded int, err error) {
+	for i := uint64(1); i < e.k; i++ {
+		if _, _, err := e.src.ReadExtra(dst); err != nil {
+			return 0, 0, err
+		}
+	}
+	return e.src.ReadExtra(dst)
+}
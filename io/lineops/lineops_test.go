@@ -0,0 +1,121 @@
+package lineops_test
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/asymmetric-research/go-commons/io/framer"
+	"github.com/asymmetric-research/go-commons/io/lineops"
+	"github.com/asymmetric-research/go-commons/io/linereader"
+	"github.com/stretchr/testify/require"
+)
+
+func lines(n int) []string {
+	out := make([]string, n)
+	for i := range out {
+		out[i] = fmt.Sprintf("%d", i+1)
+	}
+	return out
+}
+
+func readAll(t *testing.T, f framer.Framer) []string {
+	var out []string
+	buf := make([]byte, 64)
+	for {
+		n, _, err := f.ReadExtra(buf)
+		if err == io.EOF {
+			return out
+		}
+		require.NoError(t, err)
+		out = append(out, string(buf[:n]))
+	}
+}
+
+func sources(in []string) map[string]func() framer.Framer {
+	return map[string]func() framer.Framer{
+		"no trailing newline": func() framer.Framer {
+			return linereader.New(strings.NewReader(strings.Join(in, "\n")), 64)
+		},
+		"trailing newline": func() framer.Framer {
+			return linereader.New(strings.NewReader(strings.Join(in, "\n")+"\n"), 64)
+		},
+	}
+}
+
+func TestOperators(t *testing.T) {
+	in := lines(10)
+	for name, src := range sources(in) {
+		require.Equal(t, in, readAll(t, src()), name)
+
+		require.Equal(t, in[3:], readAll(t, lineops.Skip(src(), 3)), name)
+		require.Empty(t, readAll(t, lineops.Skip(src(), 10)), name)
+		require.Empty(t, readAll(t, lineops.Skip(src(), 11)), name)
+
+		require.Equal(t, in[:3], readAll(t, lineops.Head(src(), 3)), name)
+		require.Equal(t, in, readAll(t, lineops.Head(src(), 10)), name)
+		require.Equal(t, in, readAll(t, lineops.Head(src(), 11)), name)
+		require.Empty(t, readAll(t, lineops.Head(src(), 0)), name)
+
+		require.Equal(t, []string{"3", "6", "9"}, readAll(t, lineops.Every(src(), 3)), name)
+		require.Equal(t, []string{"5", "10"}, readAll(t, lineops.Every(src(), 5)), name)
+		require.Equal(t, in, readAll(t, lineops.Every(src(), 1)), name)
+		require.Equal(t, in, readAll(t, lineops.Every(src(), 0)), name)
+
+		require.Equal(t, []string{"4", "6"}, readAll(t, lineops.Head(lineops.Every(lineops.Skip(src(), 2), 2), 2)), name)
+	}
+}
+
+func TestSample(t *testing.T) {
+	in := lines(1000)
+	sample := func(seed uint64) []string {
+		s, err := lineops.NewSampler(10, seed)
+		require.NoError(t, err)
+		_, err = s.Consume(linereader.New(strings.NewReader(strings.Join(in, "\n")), 64), make([]byte, 64))
+		require.NoError(t, err)
+		require.Equal(t, uint64(1000), s.Seen())
+		var out []string
+		for _, line := range s.Sample() {
+			out = append(out, string(line))
+		}
+		return out
+	}
+
+	first := sample(42)
+	require.Len(t, first, 10)
+	require.Equal(t, first, sample(42), "same seed should give the same sample")
+	require.NotEqual(t, first, sample(43))
+
+	s, err := lineops.NewSampler(10, 0)
+	require.NoError(t, err)
+	for _, line := range in[:4] {
+		s.Add([]byte(line))
+	}
+	require.Equal(t, [][]byte{[]byte("1"), []byte("2"), []byte("3"), []byte("4")}, s.Sample())
+
+	for _, k := range []int{0, -1} {
+		_, err = lineops.NewSampler(k, 0)
+		require.Error(t, err)
+	}
+}
+
+func TestSampleUniform(t *testing.T) {
+	const n, k, rounds = 20, 5, 4000
+	hits := make([]int, n)
+	for seed := range uint64(rounds) {
+		s, err := lineops.NewSampler(k, seed)
+		require.NoError(t, err)
+		for i := range n {
+			s.Add([]byte{byte(i)})
+		}
+		for _, line := range s.Sample() {
+			hits[line[0]]++
+		}
+	}
+
+	expected := rounds * k / n
+	for i, h := range hits {
+		require.InDelta(t, expected, h, float64(expected)/5, "line %d", i)
+	}
+}
@@ -0,0 +1,87 @@
+package lineops
+
+import (
+	"cmp"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+
+	"github.com/asymmetric-research/go-commons/io/framer"
+)
+
+type sampleSlot struct {
+	idx  uint64
+	line []byte
+}
+
+// Sampler picks k lines uniformly at random from a stream of unknown length
+// using reservoir sampling. The same seed and input always produce the same
+// sample.
+type Sampler struct {
+	k     int
+	seen  uint64
+	rng   *rand.Rand
+	slots []sampleSlot
+}
+
+func NewSampler(k int, seed uint64) (*Sampler, error) {
+	s := &Sampler{}
+	return s, NewSamplerInto(s, k, seed)
+}
+
+func NewSamplerInto(dst *Sampler, k int, seed uint64) error {
+	if k <= 0 {
+		return fmt.Errorf("k must be greater than zero")
+	}
+	*dst = Sampler{
+		k:     k,
+		rng:   rand.New(rand.NewPCG(seed, seed)),
+		slots: make([]sampleSlot, 0, k),
+	}
+	return nil
+}
+
+// Add offers a line to the sample. The line is copied if it is kept; slots
+// reuse their memory when replaced.
+func (s *Sampler) Add(line []byte) {
+	idx := s.seen
+	s.seen++
+
+	if len(s.slots) < s.k {
+		s.slots = append(s.slots, sampleSlot{idx: idx, line: append([]byte(nil), line...)})
+		return
+	}
+
+	j := s.rng.Uint64N(idx + 1)
+	if j >= uint64(s.k) {
+		return
+	}
+	slot := &s.slots[j]
+	slot.idx = idx
+	slot.line = append(slot.line[:0], line...)
+}
+
+// Consume adds every line of src, see framer.Each.
+func (s *Sampler) Consume(src framer.Framer, line []byte) (ndiscarded int, err error) {
+	return framer.Each(src, line, s.Add)
+}
+
+// Seen returns the number of lines offered so far.
+func (s *Sampler) Seen() uint64 {
+	return s.seen
+}
+
+// Sample returns the sampled lines in stream order. The returned slices are
+// owned by the sampler and change with the next Add.
+func (s *Sampler) Sample() [][]byte {
+	slots := slices.Clone(s.slots)
+	slices.SortFunc(slots, func(a, b sampleSlot) int {
+		return cmp.Compare(a.idx, b.idx)
+	})
+
+	lines := make([][]byte, len(slots))
+	for i, slot := range slots {
+		lines[i] = slot.line
+	}
+	return lines
+}
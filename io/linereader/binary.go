@@ -0,0 +1,137 @@
+package linereader
+
+import (
+	"bytes"
+	"unicode/utf8"
+)
+
+type BinaryPolicy int
+
+const (
+	// BINARY_POLICY_PASS returns binary lines unchanged
+	BINARY_POLICY_PASS BinaryPolicy = iota
+	// BINARY_POLICY_ESCAPE rewrites control characters and invalid UTF-8 as
+	// \xNN and backslashes as \\, escaped lines may be truncated further, at
+	// an escape sequence or rune boundary
+	BINARY_POLICY_ESCAPE
+	// BINARY_POLICY_DROP skips binary lines
+	BINARY_POLICY_DROP
+)
+
+type binaryDetector struct {
+	enabled   bool
+	policy    BinaryPolicy
+	threshold float64
+
+	last      bool
+	nlines    uint64
+	escapebuf []byte
+}
+
+// LastLineBinary reports whether the line returned by the last read looked
+// binary. With BINARY_POLICY_DROP it is always false.
+func (lr *T) LastLineBinary() bool {
+	return lr.binary.last
+}
+
+// BinaryLines returns the number of binary lines seen so far, including
+// dropped ones.
+func (lr *T) BinaryLines() uint64 {
+	return lr.binary.nlines
+}
+
+func (lr *T) readTextLine(dst []byte) (nread int, ndiscarted int, err error) {
+	bd := &lr.binary
+	if n := len(lr.unread); n > 0 {
+		bd.last = lr.unread[n-1].binary
+		return lr.readLine(dst)
+	}
+
+	for {
+		nread, ndiscarted, err = lr.readLine(dst)
+		if err != nil {
+			bd.last = false
+			return
+		}
+		line, dropped, keep := bd.apply(dst[:nread], len(dst))
+		if !keep {
+			continue
+		}
+		nread = copy(dst, line)
+		ndiscarted += dropped
+		return
+	}
+}
+
+// apply applies the policy to line, escaping it into at most limit bytes. It
+// returns the line to use and the number of bytes of line the escaping
+// dropped, or false if the line is dropped.
+func (bd *binaryDetector) apply(line []byte, limit int) (out []byte, dropped int, keep bool) {
+	bd.last = false
+	if !bd.enabled || !isBinary(line, bd.threshold) {
+		return line, 0, true
+	}
+
+	bd.nlines++
+	switch bd.policy {
+	case BINARY_POLICY_DROP:
+		return nil, 0, false
+	case BINARY_POLICY_ESCAPE:
+		bd.escapebuf, dropped = escapeBinary(bd.escapebuf[:0], line, limit)
+		line = bd.escapebuf
+	}
+	bd.last = true
+	return line, dropped, true
+}
+
+func isBinary(line []byte, threshold float64) bool {
+	if len(line) == 0 {
+		return false
+	}
+	if bytes.IndexByte(line, 0) >= 0 {
+		return true
+	}
+	if utf8.Valid(line) {
+		return false
+	}
+
+	invalid := 0
+	for i := 0; i < len(line); {
+		r, size := utf8.DecodeRune(line[i:])
+		if r == utf8.RuneError && size == 1 {
+			invalid++
+		}
+		i += size
+	}
+	return float64(invalid)/float64(len(line)) > threshold
+}
+
+// escapeBinary appends the escaped line to dst, up to limit bytes. An escape
+// sequence or a rune that doesn't fit is dropped whole, along with the rest of
+// the line; dropped counts the bytes of line they came from.
+func escapeBinary(dst, line []byte, limit int) (out []byte, dropped int) {
+	const hex = "0123456789abcdef"
+	start := len(dst)
+	var unit [4]byte
+	for i := 0; i < len(line); {
+		r, size := utf8.DecodeRune(line[i:])
+		c := line[i]
+		var enc []byte
+		switch {
+		case r == utf8.RuneError && size == 1, c < 0x20 && c != '\t', c == 0x7f:
+			enc = append(unit[:0], '\\', 'x', hex[c>>4], hex[c&0xf])
+		case c == '\\':
+			enc = append(unit[:0], '\\', '\\')
+		default:
+			enc = line[i : i+size]
+		}
+		i += size
+
+		if dropped > 0 || len(dst)-start+len(enc) > limit {
+			dropped += size
+			continue
+		}
+		dst = append(dst, enc...)
+	}
+	return dst, dropped
+}
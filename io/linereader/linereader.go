@@ -3,7 +3,9 @@ package linereader
 import (
 	"bytes"
 	"io"
+	"time"
 
+	"github.com/asymmetric-research/go-commons/io/readahead"
 	armath "github.com/asymmetric-research/go-commons/math"
 )
 
@@ -13,22 +15,71 @@ type T struct {
 	readbuf     []byte
 	blocksize   uint
 	readerErr   error
+
+	// writebuf batches the output of WriteLinesTo
+	writebuf []byte
+
+	binary binaryDetector
+
+	// ahead is set by WithReadAhead, and used for timed reads by WithIdleFlush
+	ahead     *readahead.T
+	idleFlush time.Duration
+
+	// partial is set when the last line was returned before its newline,
+	// continued when it was the rest of a partial line
+	partial   bool
+	continued bool
+	// idled is set when PeekLine timed out waiting for the rest of a line
+	idled bool
+
+	// lines pushed back by UnreadLine, last pushed last
+	unread []unreadLine
 }
 
-func New(reader io.Reader, blockSize uint) *T {
+func New(reader io.Reader, blockSize uint, opts ...Option) *T {
 	lr := &T{}
-	NewInto(lr, reader, blockSize)
+	NewInto(lr, reader, blockSize, opts...)
 	return lr
 }
 
-func NewInto(dst *T, reader io.Reader, blockSize uint) {
+func NewInto(dst *T, reader io.Reader, blockSize uint, opts ...Option) {
+	o := options{}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	reader, ahead := o.wrap(reader, blockSize)
 	*dst = T{
 		reader:      reader,
 		readbufbase: make([]byte, blockSize),
 		blocksize:   blockSize,
+		binary:      o.binary,
+		ahead:       ahead,
+		idleFlush:   o.idleFlush,
 	}
 }
 
+// Close releases the resources used by the options, it does not close the
+// underlying reader.
+func (lr *T) Close() error {
+	if lr.ahead == nil {
+		return nil
+	}
+	return lr.ahead.Close()
+}
+
+// LastLinePartial reports whether the line returned by the last read was cut
+// short by WithIdleFlush. The next read returns the rest of it.
+func (lr *T) LastLinePartial() bool {
+	return lr.partial
+}
+
+// LastLineContinued reports whether the line returned by the last read is the
+// rest of a partial line.
+func (lr *T) LastLineContinued() bool {
+	return lr.continued
+}
+
 func (lr *T) Read(dst []byte) (n int, err error) {
 	n, discarded, err := lr.ReadExtra(dst)
 	if discarded != 0 {
@@ -40,6 +91,24 @@ func (lr *T) Read(dst []byte) (n int, err error) {
 // ReadExtra reads as much as possible into p, until the next newline or EOF is reached.
 // Every new call to read starts on a new line. The remainder of the previous line will be discarted.
 func (lr *T) ReadExtra(dst []byte) (nread int, ndiscarted int, err error) {
+	if !lr.binary.enabled {
+		return lr.readLine(dst)
+	}
+	return lr.readTextLine(dst)
+}
+
+func (lr *T) readLine(dst []byte) (nread int, ndiscarted int, err error) {
+	lr.continued = lr.partial
+	lr.partial = false
+
+	if n := len(lr.unread); n > 0 {
+		u := lr.unread[n-1]
+		lr.unread = lr.unread[:n-1]
+		lr.continued = u.continued
+		if u.partial {
+			return lr.readUnreadPartial(dst, u.n)
+		}
+	}
 
 	// check if the reader is done
 	if len(lr.readbuf) == 0 && lr.readerErr != nil {
@@ -70,7 +139,7 @@ func (lr *T) ReadExtra(dst []byte) (nread int, ndiscarted int, err error) {
 
 	for i := uint(0); ; i++ {
 		readOffset := uint(nread)
-		readLimit := armath.Min(lr.blocksize, uint(len(dst)))
+		readLimit := armath.Min(readOffset+lr.blocksize, uint(len(dst)))
 
 		// dst has been filled and there hasn't been a new line yet
 		if readLimit <= readOffset {
@@ -80,7 +149,23 @@ func (lr *T) ReadExtra(dst []byte) (nread int, ndiscarted int, err error) {
 
 		dstClamp := dst[readOffset:readLimit]
 		var n int
-		n, lr.readerErr = lr.reader.Read(dstClamp)
+		if lr.idleFlush > 0 && nread > 0 {
+			if lr.idled {
+				// PeekLine already waited for the rest
+				lr.idled = false
+				lr.partial = true
+				return nread, 0, nil
+			}
+			// part of the line is pending, don't wait forever for the rest
+			n, lr.readerErr = lr.ahead.ReadTimeout(dstClamp, lr.idleFlush)
+			if lr.readerErr == readahead.ErrTimeout {
+				lr.readerErr = nil
+				lr.partial = true
+				return nread, 0, nil
+			}
+		} else {
+			n, lr.readerErr = lr.reader.Read(dstClamp)
+		}
 		dstClamp = dstClamp[:n]
 		nread += n
 
@@ -104,7 +189,7 @@ func (lr *T) ReadExtra(dst []byte) (nread int, ndiscarted int, err error) {
 		nread -= 1
 
 		// is new line at the end of read?
-		if eolidx == int(readLimit)-1 {
+		if eolidx == n-1 {
 			// yes
 			return
 
@@ -118,34 +203,34 @@ func (lr *T) ReadExtra(dst []byte) (nread int, ndiscarted int, err error) {
 	}
 }
 
+// discardRestOfLine skips to the start of the next line, and returns the
+// number of bytes skipped.
 func (lr *T) discardRestOfLine() int {
 	// discard the rest of the line in the read buffer
 
+	discarded := 0
 	if len(lr.readbuf) > 0 {
 		if idx := bytes.IndexByte(lr.readbuf, '\n'); idx >= 0 {
 			lr.readbuf = lr.readbuf[idx+1:]
 			return idx
-		} else {
-			lr.readbuf = nil
 		}
+		discarded = len(lr.readbuf)
+		lr.readbuf = nil
 	}
 
 	// discard the rest of the line in the reader
 
-	prevread := 0
-	for {
-		n, err := lr.reader.Read(lr.readbufbase)
+	for lr.readerErr == nil {
+		var n int
+		n, lr.readerErr = lr.reader.Read(lr.readbufbase)
 		lr.readbuf = lr.readbufbase[:n]
-		if err != nil {
-			return n
-		}
-
-		eolidx := bytes.IndexByte(lr.readbuf, '\n')
 
-		if eolidx >= 0 {
+		if eolidx := bytes.IndexByte(lr.readbuf, '\n'); eolidx >= 0 {
 			lr.readbuf = lr.readbuf[eolidx+1:]
-			return eolidx + prevread
+			return discarded + eolidx
 		}
-		prevread += n
+		discarded += n
+		lr.readbuf = nil
 	}
+	return discarded
 }
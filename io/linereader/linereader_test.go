@@ -1,12 +1,15 @@
 package linereader_test
 
 import (
+	"bufio"
 	"bytes"
+	"embed"
+	"fmt"
 	"io"
-	"path"
-	"runtime"
 	"strings"
 	"testing"
+	"testing/iotest"
+	"time"
 
 	"github.com/asymmetric-research/go-commons/io/linereader"
 	"github.com/asymmetric-research/go-commons/io/readchunkdump"
@@ -16,6 +19,9 @@ import (
 	hashiline "github.com/mitchellh/go-linereader"
 )
 
+//go:embed readerchunks0.rcd readerchunkstruncated.rcd
+var fixtures embed.FS
+
 func TestLineReader(t *testing.T) {
 	expectedLines := strings.Split(report, "\n")
 
@@ -78,15 +84,12 @@ func TestLinesOfReaderTruncation(t *testing.T) {
 }
 
 func TestReplay(t *testing.T) {
-	_, currentFile, _, _ := runtime.Caller(0)
-	currentDir := path.Dir(currentFile)
-
-	r, err := readchunkdump.NewReplayer(
-		path.Join(currentDir, "readerchunks0"),
-	)
+	r, err := readchunkdump.NewReplayerFS(fixtures, "readerchunks0.rcd")
 	require.NoError(t, err)
-	lr := linereader.New(r, 1024*4)        // 4K read buffer
-	backingBuf := [20 * 1024 * 1024]byte{} // 20MB max line
+	// a threshold of 1 only flags lines containing NUL bytes
+	nulDetection := linereader.WithBinaryDetection(linereader.BINARY_POLICY_PASS, 1)
+	lr := linereader.New(r, 1024*4, nulDetection) // 4K read buffer
+	backingBuf := [20 * 1024 * 1024]byte{}        // 20MB max line
 
 	for i := 0; ; i++ {
 		n, dis, rerr := lr.ReadExtra(backingBuf[:])
@@ -98,6 +101,7 @@ func TestReplay(t *testing.T) {
 			t.FailNow()
 		}
 		if rerr == io.EOF {
+			require.Zero(t, lr.BinaryLines())
 			return
 		}
 	}
@@ -159,11 +163,80 @@ func BenchmarkGoCmdLargeReads(b *testing.B) {
 	})
 }
 
-func runOurs(t require.TestingT, r io.Reader) {
+// Read-ahead benchmarks
+func BenchmarkLineReaderReadAheadUnbuffered(b *testing.B) {
+	b.RunParallel(func(p *testing.PB) {
+		for p.Next() {
+			reader := NewLineByLineReader(report)
+			runOurs(b, reader, linereader.WithReadAhead())
+		}
+	})
+}
+
+func BenchmarkLineReaderReadAheadLargeReads(b *testing.B) {
+	b.RunParallel(func(p *testing.PB) {
+		for p.Next() {
+			reader := strings.NewReader(report)
+			runOurs(b, reader, linereader.WithReadAhead())
+		}
+	})
+}
+
+// Slow benchmarks, both the reader and the consumer take time
+func BenchmarkLineReaderSlow(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		reader := &latencyReader{r: NewLineByLineReader(report), latency: 20 * time.Microsecond}
+		runOursWithWork(b, reader, 20*time.Microsecond)
+	}
+}
+
+func BenchmarkLineReaderReadAheadSlow(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		reader := &latencyReader{r: NewLineByLineReader(report), latency: 20 * time.Microsecond}
+		runOursWithWork(b, reader, 20*time.Microsecond, linereader.WithReadAhead())
+	}
+}
+
+// latencyReader simulates a high latency source, like a network filesystem.
+type latencyReader struct {
+	r       io.Reader
+	latency time.Duration
+}
+
+func (l *latencyReader) Read(dst []byte) (int, error) {
+	time.Sleep(l.latency)
+	return l.r.Read(dst)
+}
+
+// spin simulates work on the consumer side, it keeps the CPU busy.
+func spin(d time.Duration) {
+	for start := time.Now(); time.Since(start) < d; {
+	}
+}
+
+func runOursWithWork(t require.TestingT, r io.Reader, work time.Duration, opts ...linereader.Option) {
 	var err error
 	rd := linereader.T{}
 	lineBacking := [8192]byte{}
-	linereader.NewInto(&rd, r, 4096)
+	linereader.NewInto(&rd, r, 4096, opts...)
+	defer rd.Close()
+
+	cnt := 0
+	for err == nil {
+		_, _, err = rd.ReadExtra(lineBacking[:])
+		spin(work)
+		cnt += 1
+	}
+	cnt -= 1 // account for the last error
+	require.Equal(t, reportLineCount, cnt)
+}
+
+func runOurs(t require.TestingT, r io.Reader, opts ...linereader.Option) {
+	var err error
+	rd := linereader.T{}
+	lineBacking := [8192]byte{}
+	linereader.NewInto(&rd, r, 4096, opts...)
+	defer rd.Close()
 
 	cnt := 0
 	for err == nil {
@@ -539,15 +612,12 @@ func init() {
 }
 
 func TestTruncated(t *testing.T) {
-	_, currentFile, _, _ := runtime.Caller(0)
-	currentDir := path.Dir(currentFile)
-
-	r, err := readchunkdump.NewReplayer(
-		path.Join(currentDir, "readerchunkstruncated"),
-	)
+	r, err := readchunkdump.NewReplayerFS(fixtures, "readerchunkstruncated.rcd")
 	require.NoError(t, err)
-	lr := linereader.New(r, 1024*4)        // 4K read buffer
-	backingBuf := [20 * 1024 * 1024]byte{} // 20MB max line
+	// a threshold of 1 only flags lines containing NUL bytes
+	nulDetection := linereader.WithBinaryDetection(linereader.BINARY_POLICY_PASS, 1)
+	lr := linereader.New(r, 1024*4, nulDetection) // 4K read buffer
+	backingBuf := [20 * 1024 * 1024]byte{}        // 20MB max line
 
 	for i := 0; ; i++ {
 		n, dis, rerr := lr.ReadExtra(backingBuf[:])
@@ -560,7 +630,540 @@ func TestTruncated(t *testing.T) {
 			t.FailNow()
 		}
 		if rerr == io.EOF {
+			require.Zero(t, lr.BinaryLines())
 			return
 		}
 	}
 }
+
+type countingWriter struct {
+	bytes.Buffer
+	writes int
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.writes++
+	return w.Buffer.Write(p)
+}
+
+func TestWriteLinesTo(t *testing.T) {
+	var expected strings.Builder
+	for _, line := range strings.Split(report, "\n") {
+		if strings.HasPrefix(line, "[+]") {
+			continue
+		}
+		expected.WriteString("> " + line + "\n")
+	}
+
+	prefixNonStatus := func(out, line []byte) []byte {
+		if bytes.HasPrefix(line, []byte("[+]")) {
+			return out
+		}
+		out = append(out, "> "...)
+		out = append(out, line...)
+		return append(out, '\n')
+	}
+
+	for _, r := range []io.Reader{NewLineByLineReader(report), strings.NewReader(report)} {
+		lr := linereader.New(r, 4096)
+		w := &countingWriter{}
+		scratch := [8192]byte{}
+
+		written, discarded, err := lr.WriteLinesTo(w, scratch[:], prefixNonStatus)
+		require.NoError(t, err)
+		require.Zero(t, discarded)
+		require.Equal(t, int64(expected.Len()), written)
+		require.Equal(t, expected.String(), w.String())
+		require.Less(t, w.writes, 10, "writes should be batched")
+	}
+}
+
+func TestWriteLinesToAfterRead(t *testing.T) {
+	lr := linereader.New(strings.NewReader("first\nsecond\nthird"), 8)
+	line := [16]byte{}
+	n, _, err := lr.ReadExtra(line[:])
+	require.NoError(t, err)
+	require.Equal(t, "first", string(line[:n]))
+
+	var out bytes.Buffer
+	scratch := [4]byte{}
+	_, discarded, err := lr.WriteLinesTo(&out, scratch[:], nil)
+	require.NoError(t, err)
+	require.Equal(t, "seco\nthir\n", out.String())
+	require.Equal(t, 3, discarded)
+}
+
+func TestWriteLinesToTruncates(t *testing.T) {
+	in := "a line longer than scratch\nshort\n\nanother long line\nend"
+	for _, blockSize := range []uint{4, 64} {
+		lr := linereader.New(strings.NewReader(in), blockSize)
+		var expected strings.Builder
+		expectedDiscarded := 0
+		line := [8]byte{}
+		for {
+			n, discarded, err := lr.ReadExtra(line[:])
+			if err == io.EOF {
+				break
+			}
+			require.NoError(t, err)
+			expected.Write(line[:n])
+			expected.WriteByte('\n')
+			expectedDiscarded += discarded
+		}
+
+		lr = linereader.New(strings.NewReader(in), blockSize)
+		var out bytes.Buffer
+		scratch := [8]byte{}
+		_, discarded, err := lr.WriteLinesTo(&out, scratch[:], nil)
+		require.NoError(t, err)
+		require.Equal(t, expected.String(), out.String(), "block size %d", blockSize)
+		require.Equal(t, expectedDiscarded, discarded, "block size %d", blockSize)
+	}
+}
+
+func TestWriteLinesToBinary(t *testing.T) {
+	in := "text\nbin\x00\n\x00\x01\x02\x03\x04\nend\x00"
+	for _, policy := range []linereader.BinaryPolicy{linereader.BINARY_POLICY_DROP, linereader.BINARY_POLICY_ESCAPE} {
+		for _, blockSize := range []uint{4, 64} {
+			opt := linereader.WithBinaryDetection(policy, 0)
+			lr := linereader.New(strings.NewReader(in), blockSize, opt)
+			var expected strings.Builder
+			expectedDiscarded := 0
+			line := [8]byte{}
+			for {
+				n, discarded, err := lr.ReadExtra(line[:])
+				if err == io.EOF {
+					break
+				}
+				require.NoError(t, err)
+				expected.Write(line[:n])
+				expected.WriteByte('\n')
+				expectedDiscarded += discarded
+			}
+
+			wlr := linereader.New(strings.NewReader(in), blockSize, opt)
+			var out bytes.Buffer
+			scratch := [8]byte{}
+			_, discarded, err := wlr.WriteLinesTo(&out, scratch[:], nil)
+			require.NoError(t, err)
+			require.Equal(t, expected.String(), out.String(), "policy %d, block size %d", policy, blockSize)
+			require.Equal(t, expectedDiscarded, discarded, "policy %d, block size %d", policy, blockSize)
+			require.Equal(t, uint64(3), wlr.BinaryLines())
+			if policy == linereader.BINARY_POLICY_DROP {
+				require.Equal(t, "text\n", out.String())
+			}
+		}
+	}
+}
+
+func TestStripANSI(t *testing.T) {
+	in := "\x1b[1;31merror\x1b[0m: failed\n[  0%]\r\x1b[K[ 50%]\r\x1b[K[100%] done\n"
+
+	lr := linereader.New(iotest.OneByteReader(strings.NewReader(in)), 64, linereader.WithStripANSI(false))
+	line := [64]byte{}
+	var lines []string
+	for {
+		n, _, err := lr.ReadExtra(line[:])
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		lines = append(lines, string(line[:n]))
+	}
+	require.Equal(t, []string{"error: failed", "[  0%]\r[ 50%]\r[100%] done"}, lines)
+
+	lr = linereader.New(iotest.OneByteReader(strings.NewReader(in)), 64, linereader.WithStripANSI(true))
+	lines = nil
+	for {
+		n, _, err := lr.ReadExtra(line[:])
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		lines = append(lines, string(line[:n]))
+	}
+	require.Equal(t, []string{"error: failed", "[100%] done"}, lines)
+}
+
+func TestBinaryDetection(t *testing.T) {
+	in := "text\nnul\x00byte\nlatin1 caf\xe9\n\xff\xfe\xfd\xfc\nutf-8 café\n"
+
+	read := func(opts ...linereader.Option) (lines []string, binary []bool, lr *linereader.T) {
+		lr = linereader.New(strings.NewReader(in), 64, opts...)
+		line := [64]byte{}
+		for {
+			n, _, err := lr.ReadExtra(line[:])
+			if err == io.EOF {
+				return
+			}
+			require.NoError(t, err)
+			lines = append(lines, string(line[:n]))
+			binary = append(binary, lr.LastLineBinary())
+		}
+	}
+
+	lines, binary, lr := read(linereader.WithBinaryDetection(linereader.BINARY_POLICY_PASS, 0.5))
+	require.Equal(t, []string{"text", "nul\x00byte", "latin1 caf\xe9", "\xff\xfe\xfd\xfc", "utf-8 café"}, lines)
+	require.Equal(t, []bool{false, true, false, true, false}, binary)
+	require.Equal(t, uint64(2), lr.BinaryLines())
+
+	lines, binary, lr = read(linereader.WithBinaryDetection(linereader.BINARY_POLICY_ESCAPE, 0))
+	require.Equal(t, []string{"text", `nul\x00byte`, `latin1 caf\xe9`, `\xff\xfe\xfd\xfc`, "utf-8 café"}, lines)
+	require.Equal(t, []bool{false, true, true, true, false}, binary)
+	require.Equal(t, uint64(3), lr.BinaryLines())
+
+	lines, _, lr = read(linereader.WithBinaryDetection(linereader.BINARY_POLICY_DROP, 0))
+	require.Equal(t, []string{"text", "utf-8 café"}, lines)
+	require.Equal(t, uint64(3), lr.BinaryLines())
+}
+
+func TestBinaryEscapeTruncates(t *testing.T) {
+	lr := linereader.New(strings.NewReader("\x00\x01\x02\x03\n"), 64, linereader.WithBinaryDetection(linereader.BINARY_POLICY_ESCAPE, 0))
+	line := [10]byte{}
+	n, discarded, err := lr.ReadExtra(line[:])
+	require.NoError(t, err)
+	require.Equal(t, `\x00\x01`, string(line[:n]))
+	require.Equal(t, 2, discarded, "bytes of the line, not of its escaped form")
+
+	// escape sequences and runes are never cut in half
+	lr = linereader.New(strings.NewReader("a\x00é\x01\n"), 64, linereader.WithBinaryDetection(linereader.BINARY_POLICY_ESCAPE, 0))
+	n, discarded, err = lr.ReadExtra(line[:6])
+	require.NoError(t, err)
+	require.Equal(t, `a\x00`, string(line[:n]))
+	require.Equal(t, len("é\x01"), discarded)
+}
+
+func readLines(t *testing.T, lr *linereader.T, bufSize int) []string {
+	line := make([]byte, bufSize)
+	var lines []string
+	for {
+		n, _, err := lr.ReadExtra(line)
+		if err == io.EOF {
+			return lines
+		}
+		require.NoError(t, err)
+		lines = append(lines, string(line[:n]))
+	}
+}
+
+func TestReadAhead(t *testing.T) {
+	for _, r := range []io.Reader{NewLineByLineReader(report), strings.NewReader(report)} {
+		runOurs(t, r, linereader.WithReadAhead())
+	}
+
+	// closing stops a reader blocked on its source
+	pr, pw := io.Pipe()
+	defer pw.Close()
+	lr := linereader.New(pr, 64, linereader.WithReadAhead())
+	require.NoError(t, lr.Close())
+	_, _, err := lr.ReadExtra(make([]byte, 64))
+	require.Error(t, err)
+}
+
+func TestIdleFlush(t *testing.T) {
+	pr, pw := io.Pipe()
+	lr := linereader.New(pr, 64, linereader.WithIdleFlush(20*time.Millisecond))
+	defer lr.Close()
+
+	// the whole stream is also readable without the writer pausing
+	runOurs(t, strings.NewReader(report), linereader.WithIdleFlush(time.Minute))
+
+	type line struct {
+		text               string
+		partial, continued bool
+	}
+	read := func() line {
+		buf := make([]byte, 64)
+		n, _, err := lr.ReadExtra(buf)
+		require.NoError(t, err)
+		return line{string(buf[:n]), lr.LastLinePartial(), lr.LastLineContinued()}
+	}
+
+	go pw.Write([]byte("Password: "))
+	require.Equal(t, line{"Password: ", true, false}, read())
+
+	go pw.Write([]byte("hunter2\n(gdb) "))
+	require.Equal(t, line{"hunter2", false, true}, read())
+	require.Equal(t, line{"(gdb) ", true, false}, read())
+
+	// the newline alone ends the partial line
+	go pw.Write([]byte("\nrun\n"))
+	require.Equal(t, line{"", false, true}, read())
+	require.Equal(t, line{"run", false, false}, read())
+
+	// nothing pending, the reader waits
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		pw.Write([]byte("late\n"))
+		pw.Close()
+	}()
+	require.Equal(t, line{"late", false, false}, read())
+	_, _, err := lr.ReadExtra(make([]byte, 64))
+	require.Equal(t, io.EOF, err)
+}
+
+func TestPeekIdleFlushed(t *testing.T) {
+	pr, pw := io.Pipe()
+	lr := linereader.New(pr, 64, linereader.WithIdleFlush(20*time.Millisecond))
+	defer lr.Close()
+
+	type line struct {
+		text               string
+		partial, continued bool
+	}
+	buf := make([]byte, 64)
+	peek := func() line {
+		n, _, err := lr.PeekLine(buf)
+		require.NoError(t, err)
+		return line{string(buf[:n]), lr.LastLinePartial(), lr.LastLineContinued()}
+	}
+	read := func() line {
+		n, _, err := lr.ReadExtra(buf)
+		require.NoError(t, err)
+		return line{string(buf[:n]), lr.LastLinePartial(), lr.LastLineContinued()}
+	}
+
+	// a partial line is peeked without a newline, and stays partial
+	go pw.Write([]byte("Password: "))
+	require.Equal(t, line{"Password: ", true, false}, peek())
+	require.Equal(t, line{"Password: ", true, false}, peek())
+	require.Equal(t, line{"Password: ", true, false}, read())
+
+	go func() {
+		pw.Write([]byte("hunter2\nok\n"))
+		pw.Close()
+	}()
+	require.Equal(t, line{"hunter2", false, true}, peek())
+	require.Equal(t, line{"hunter2", false, true}, read())
+	require.Equal(t, line{"ok", false, false}, read())
+}
+
+func TestPeekLine(t *testing.T) {
+	for _, r := range []io.Reader{
+		strings.NewReader("first\nsecond\nthird"),
+		iotest.OneByteReader(strings.NewReader("first\nsecond\nthird")),
+		NewLineByLineReader("first\nsecond\nthird"),
+	} {
+		lr := linereader.New(r, 8)
+		line := [16]byte{}
+
+		for range 2 {
+			n, _, err := lr.PeekLine(line[:])
+			require.NoError(t, err)
+			require.Equal(t, "first", string(line[:n]))
+		}
+
+		n, _, err := lr.ReadExtra(line[:])
+		require.NoError(t, err)
+		require.Equal(t, "first", string(line[:n]))
+
+		n, _, err = lr.PeekLine(line[:])
+		require.NoError(t, err)
+		require.Equal(t, "second", string(line[:n]))
+
+		require.Equal(t, []string{"second", "third"}, readLines(t, lr, 16))
+
+		_, _, err = lr.PeekLine(line[:])
+		require.ErrorIs(t, err, io.EOF)
+	}
+}
+
+func TestPeekLineShortBuffer(t *testing.T) {
+	long := "a line spanning several blocks"
+	for _, r := range []io.Reader{
+		strings.NewReader(long + "\nnext"),
+		iotest.OneByteReader(strings.NewReader(long + "\nnext")),
+	} {
+		lr := linereader.New(r, 4)
+		line := [64]byte{}
+
+		// nothing is consumed when the line doesn't fit
+		_, _, err := lr.PeekLine(line[:8])
+		require.ErrorIs(t, err, io.ErrShortBuffer)
+		n, discarded, err := lr.PeekLine(line[:len(long)])
+		require.NoError(t, err)
+		require.Zero(t, discarded)
+		require.Equal(t, long, string(line[:n]))
+
+		require.Equal(t, []string{long, "next"}, readLines(t, lr, 64))
+	}
+
+	// the line is already whole in the read buffer
+	lr := linereader.New(strings.NewReader("0123456789\nab\n"), 64)
+	line := [64]byte{}
+	_, _, err := lr.PeekLine(line[:4])
+	require.ErrorIs(t, err, io.ErrShortBuffer)
+	require.Equal(t, []string{"0123456789", "ab"}, readLines(t, lr, 64))
+
+	// the escaped line has to fit
+	lr = linereader.New(strings.NewReader("\x00\x01\n"), 4, linereader.WithBinaryDetection(linereader.BINARY_POLICY_ESCAPE, 0))
+	_, _, err = lr.PeekLine(line[:4])
+	require.ErrorIs(t, err, io.ErrShortBuffer)
+	require.Equal(t, []string{`\x00\x01`}, readLines(t, lr, 8))
+
+	// dropped lines are skipped once
+	lr = linereader.New(strings.NewReader("\x00\x01\ntext\n"), 4, linereader.WithBinaryDetection(linereader.BINARY_POLICY_DROP, 0))
+	n, _, err := lr.PeekLine(line[:8])
+	require.NoError(t, err)
+	require.Equal(t, "text", string(line[:n]))
+	require.Equal(t, []string{"text"}, readLines(t, lr, 8))
+	require.Equal(t, uint64(1), lr.BinaryLines())
+}
+
+func TestUnreadLine(t *testing.T) {
+	lr := linereader.New(strings.NewReader("a\nb\nc\nd"), 4)
+	line := [4]byte{}
+
+	var read []string
+	for range 3 {
+		n, _, err := lr.ReadExtra(line[:])
+		require.NoError(t, err)
+		read = append(read, string(line[:n]))
+	}
+	require.Equal(t, []string{"a", "b", "c"}, read)
+
+	// more than a block of lookahead grows the read buffer
+	for i := len(read) - 1; i >= 0; i-- {
+		lr.UnreadLine([]byte(read[i]))
+	}
+	lr.UnreadLine([]byte("pushed"))
+	require.Equal(t, []string{"pushed", "a", "b", "c", "d"}, readLines(t, lr, 8))
+
+	// pushing back after EOF
+	lr.UnreadLine([]byte("d"))
+	require.Equal(t, []string{"d"}, readLines(t, lr, 8))
+}
+
+func TestUnreadKeepsBinaryClassification(t *testing.T) {
+	lr := linereader.New(
+		strings.NewReader("bin\x00\ntext\n"),
+		64,
+		linereader.WithBinaryDetection(linereader.BINARY_POLICY_ESCAPE, 0),
+	)
+	line := [16]byte{}
+
+	n, _, err := lr.PeekLine(line[:])
+	require.NoError(t, err)
+	require.Equal(t, `bin\x00`, string(line[:n]))
+	require.True(t, lr.LastLineBinary())
+
+	n, _, err = lr.ReadExtra(line[:])
+	require.NoError(t, err)
+	require.Equal(t, `bin\x00`, string(line[:n]))
+	require.True(t, lr.LastLineBinary())
+	require.Equal(t, uint64(1), lr.BinaryLines())
+
+	n, _, err = lr.ReadExtra(line[:])
+	require.NoError(t, err)
+	require.Equal(t, "text", string(line[:n]))
+	require.False(t, lr.LastLineBinary())
+}
+
+// scanLines splits data with a bufio.Scanner, keeping carriage returns.
+func scanLines(data []byte) []string {
+	s := bufio.NewScanner(bytes.NewReader(data))
+	s.Buffer(make([]byte, 0, 64), len(data)+1)
+	s.Split(func(data []byte, atEOF bool) (int, []byte, error) {
+		if i := bytes.IndexByte(data, '\n'); i >= 0 {
+			return i + 1, data[:i], nil
+		}
+		if atEOF && len(data) > 0 {
+			return len(data), data, nil
+		}
+		return 0, nil, nil
+	})
+
+	var lines []string
+	for s.Scan() {
+		lines = append(lines, s.Text())
+	}
+	return lines
+}
+
+// checkAgainstScanner reads r, the chunked data, and compares the lines to
+// the ones of bufio.Scanner, truncated to dstSize.
+func checkAgainstScanner(t *testing.T, r io.Reader, data []byte, blockSize uint, dstSize int) {
+	lr := linereader.New(r, blockSize)
+	dst := make([]byte, dstSize)
+
+	for i, line := range scanLines(data) {
+		n, discarded, err := lr.ReadExtra(dst)
+		require.NoError(t, err, "line %d", i)
+
+		expected := line[:min(len(line), dstSize)]
+		require.Equal(t, expected, string(dst[:n]), "line %d", i)
+		require.Equal(t, len(line)-len(expected), discarded, "line %d", i)
+	}
+	_, _, err := lr.ReadExtra(dst)
+	require.Equal(t, io.EOF, err)
+}
+
+func TestRechunked(t *testing.T) {
+	data := []byte("first\nsecond line\r\n\n\nlonger than a block of sixteen bytes\nlast")
+	rc := readchunkdump.NewRechunker(data, '\n')
+	for _, blockSize := range []uint{4, 16, 64} {
+		for _, dstSize := range []int{8, 64} {
+			for name, r := range rc.All(8) {
+				t.Run(fmt.Sprintf("%d/%d/%s", blockSize, dstSize, name), func(t *testing.T) {
+					checkAgainstScanner(t, r, data, blockSize, dstSize)
+				})
+			}
+		}
+	}
+}
+
+func FuzzLineReader(f *testing.F) {
+	for _, seed := range []string{
+		"",
+		"\n",
+		"a",
+		"a\n\n",
+		"a\r\nb\r",
+		"first\nsecond\n\nthird",
+		strings.Repeat("x", 100) + "\nshort\n",
+	} {
+		readchunkdump.AddSeeds(f, []byte(seed))
+	}
+	f.Add([]byte("some\nlonger lines\nto truncate\n"), uint8(readchunkdump.PATTERN_RANDOM), uint64(1<<16|7))
+
+	f.Fuzz(func(t *testing.T, data []byte, pattern uint8, param uint64) {
+		r := readchunkdump.NewRechunker(data, '\n').Pattern(readchunkdump.Pattern(pattern), param)
+
+		// the high bits of param pick the sizes, 0 doesn't truncate
+		blockSize := uint(param>>8%32) + 1
+		dstSize := len(data) + 1
+		if truncate := int(param >> 16 % 64); truncate > 0 {
+			dstSize = truncate
+		}
+		checkAgainstScanner(t, r, data, blockSize, dstSize)
+	})
+}
+
+// Lines longer than the block size used to be cut at the first block, and the
+// discarded count missed the bytes already buffered.
+func TestLongLineOverShortBlockDropsNoData(t *testing.T) {
+	long := "0123456789abcdefghij"
+	lr := linereader.New(strings.NewReader(long+"\nnext\n"+long+"\nlast"), 4)
+
+	dst := make([]byte, 64)
+	n, discarded, err := lr.ReadExtra(dst)
+	require.NoError(t, err)
+	require.Equal(t, long, string(dst[:n]))
+	require.Zero(t, discarded)
+
+	n, discarded, err = lr.ReadExtra(dst)
+	require.NoError(t, err)
+	require.Equal(t, "next", string(dst[:n]))
+	require.Zero(t, discarded)
+
+	short := make([]byte, 6)
+	n, discarded, err = lr.ReadExtra(short)
+	require.NoError(t, err)
+	require.Equal(t, long[:6], string(short[:n]))
+	require.Equal(t, len(long)-6, discarded)
+
+	n, discarded, err = lr.ReadExtra(dst)
+	require.NoError(t, err)
+	require.Equal(t, "last", string(dst[:n]))
+	require.Zero(t, discarded)
+}
@@ -0,0 +1,31 @@
+package linereader
+
+import (
+	"errors"
+	"io"
+	"iter"
+)
+
+// Lines iterates over the remaining lines, using dst as the line buffer. The
+// yielded line is only valid until the next iteration. A line longer than dst
+// is yielded truncated together with an *ErrLineTruncated. Iteration ends at
+// EOF; any other error is yielded with a nil line and ends it.
+func (lr *T) Lines(dst []byte) iter.Seq2[[]byte, error] {
+	return func(yield func([]byte, error) bool) {
+		for {
+			n, err := lr.Read(dst)
+			if err == io.EOF {
+				return
+			}
+
+			var truncated *ErrLineTruncated
+			if err != nil && !errors.As(err, &truncated) {
+				yield(nil, err)
+				return
+			}
+			if !yield(dst[:n], err) {
+				return
+			}
+		}
+	}
+}
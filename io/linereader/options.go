@@ -0,0 +1,80 @@
+package linereader
+
+import (
+	"io"
+	"time"
+
+	"github.com/asymmetric-research/go-commons/io/ansi"
+	"github.com/asymmetric-research/go-commons/io/readahead"
+)
+
+type Option func(*options)
+
+type options struct {
+	stripANSI    bool
+	collapseANSI bool
+	binary       binaryDetector
+	readAhead    bool
+	idleFlush    time.Duration
+}
+
+// WithStripANSI removes ANSI escape sequences, such as colors and cursor
+// movements, before splitting lines. With collapse, carriage returns and
+// cursor movements are interpreted so that a progress bar comes out as its
+// final visible text. See ansi.Stripper.
+func WithStripANSI(collapse bool) Option {
+	return func(o *options) {
+		o.stripANSI = true
+		o.collapseANSI = collapse
+	}
+}
+
+// WithBinaryDetection flags lines that look binary: lines containing a NUL
+// byte, or whose fraction of bytes that aren't valid UTF-8 is above threshold.
+// policy decides what happens to them. Detection applies to Read and
+// ReadExtra. See LastLineBinary and BinaryLines.
+func WithBinaryDetection(policy BinaryPolicy, threshold float64) Option {
+	return func(o *options) {
+		o.binary = binaryDetector{
+			enabled:   true,
+			policy:    policy,
+			threshold: threshold,
+		}
+	}
+}
+
+// WithReadAhead reads the next block in a background goroutine while the
+// current one is being consumed. Close must be called to stop the goroutine
+// if the reader isn't read until EOF. See readahead.T.
+func WithReadAhead() Option {
+	return func(o *options) {
+		o.readAhead = true
+	}
+}
+
+// WithIdleFlush returns the pending part of a line once no data has arrived
+// for d, instead of waiting for its newline: prompts such as "Password: " are
+// delivered while the program waits for input. The rest of the line is
+// returned by the next read. See LastLinePartial and LastLineContinued.
+//
+// It implies WithReadAhead and applies to Read and ReadExtra. In collapse
+// mode, the ANSI stripper holds back a line until it is complete.
+func WithIdleFlush(d time.Duration) Option {
+	return func(o *options) {
+		o.readAhead = true
+		o.idleFlush = d
+	}
+}
+
+// wrap stacks the readers needed by the options on top of reader. ahead is
+// the read-ahead reader on top of the stack, if any.
+func (o *options) wrap(reader io.Reader, blockSize uint) (wrapped io.Reader, ahead *readahead.T) {
+	if o.stripANSI {
+		reader = ansi.NewStripper(reader, blockSize, o.collapseANSI)
+	}
+	if o.readAhead {
+		ahead = readahead.New(reader, blockSize)
+		reader = ahead
+	}
+	return reader, ahead
+}
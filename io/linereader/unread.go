@@ -0,0 +1,184 @@
+package linereader
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/asymmetric-research/go-commons/io/readahead"
+)
+
+// unreadLine is the state of a line pushed back by UnreadLine.
+type unreadLine struct {
+	// n is the length of the line, which has no newline in the read buffer
+	// when it is partial
+	n         int
+	partial   bool
+	continued bool
+	binary    bool
+}
+
+// UnreadLine pushes line back in front of the unread data, so that the next
+// read returns it again. Lines can be pushed back repeatedly, they are read
+// back in the reverse order. line is copied into the read buffer, in place
+// when it was just read from it. If there is not enough room the read buffer
+// grows, so the lookahead is only bounded by what is pushed back.
+//
+// line takes the state of the last line read: read back, it is partial or
+// continued like that line was, and with binary detection it keeps its
+// classification and is not counted again. A partial line is read back
+// without being joined to the rest of it.
+func (lr *T) UnreadLine(line []byte) {
+	need := len(line)
+	if !lr.partial {
+		need++
+	}
+
+	// readbuf is always a suffix of readbufbase's memory, off is where it starts
+	base := lr.readbufbase
+	off := cap(base) - cap(lr.readbuf)
+	if lr.readbuf == nil {
+		off = len(base)
+	}
+
+	if off < need {
+		if len(lr.readbuf)+need > len(base) {
+			grown := make([]byte, len(lr.readbuf)+need+int(lr.blocksize))
+			base = grown
+		}
+		// move the unread data to the end of the buffer to make room in front
+		end := len(base) - len(lr.readbuf)
+		copy(base[end:], lr.readbuf)
+		lr.readbufbase = base
+		off = end
+	}
+
+	start := off - need
+	copy(base[start:], line)
+	if !lr.partial {
+		base[off-1] = '\n'
+	}
+	lr.readbuf = base[start : off+len(lr.readbuf)]
+
+	lr.unread = append(lr.unread, unreadLine{
+		n:         len(line),
+		partial:   lr.partial,
+		continued: lr.continued,
+		binary:    lr.binary.last,
+	})
+}
+
+// readUnreadPartial reads back a partial line of n bytes pushed back by
+// UnreadLine.
+func (lr *T) readUnreadPartial(dst []byte, n int) (nread int, ndiscarted int, err error) {
+	nread = copy(dst, lr.readbuf[:n])
+	lr.readbuf = lr.readbuf[n:]
+	lr.partial = true
+	return nread, n - nread, nil
+}
+
+// PeekLine reads the next line into dst without consuming it, the next read
+// returns it again. A line that doesn't fit into dst, after escaping with
+// BINARY_POLICY_ESCAPE, is not read: PeekLine returns io.ErrShortBuffer and
+// consumes nothing, so ndiscarded is always zero.
+func (lr *T) PeekLine(dst []byte) (nread int, ndiscarded int, err error) {
+	if err = lr.bufferLine(len(dst)); err != nil {
+		return 0, 0, err
+	}
+	nread, ndiscarded, err = lr.ReadExtra(dst)
+	if err != nil {
+		return
+	}
+	lr.UnreadLine(dst[:nread])
+	return
+}
+
+// bufferLine reads ahead until the next line is whole in the read buffer, so
+// that reading it doesn't touch the reader, and checks that it is returned in
+// at most limit bytes.
+func (lr *T) bufferLine(limit int) error {
+	if n := len(lr.unread); n > 0 {
+		if lr.unread[n-1].n > limit {
+			return io.ErrShortBuffer
+		}
+		return nil
+	}
+
+	for {
+		idx := bytes.IndexByte(lr.readbuf, '\n')
+		if idx < 0 && len(lr.readbuf) > limit {
+			return io.ErrShortBuffer
+		}
+
+		line := lr.readbuf
+		if idx >= 0 {
+			line = lr.readbuf[:idx]
+		} else if lr.readerErr == nil {
+			if !lr.readMore() {
+				continue
+			}
+			// a partial line as long as dst may go on, reading it would
+			// discard the rest
+			line = lr.readbuf
+			if len(line) >= limit {
+				return io.ErrShortBuffer
+			}
+			lr.idled = true
+		}
+
+		bd := &lr.binary
+		binary := bd.enabled && isBinary(line, bd.threshold)
+		if binary && bd.policy == BINARY_POLICY_DROP {
+			// skip it like a read would
+			bd.nlines++
+			lr.readbuf = lr.readbuf[min(len(line)+1, len(lr.readbuf)):]
+			lr.idled = false
+			continue
+		}
+		if len(line) > limit {
+			return io.ErrShortBuffer
+		}
+		if binary && bd.policy == BINARY_POLICY_ESCAPE {
+			var dropped int
+			bd.escapebuf, dropped = escapeBinary(bd.escapebuf[:0], line, limit)
+			if dropped > 0 {
+				lr.idled = false
+				return io.ErrShortBuffer
+			}
+		}
+		return nil
+	}
+}
+
+// readMore appends a block of the reader to the read buffer, growing it when
+// it is full. With WithIdleFlush it reports when nothing came in time.
+func (lr *T) readMore() (timedOut bool) {
+	base := lr.readbufbase
+	off := cap(base) - cap(lr.readbuf)
+	if lr.readbuf == nil {
+		off = len(base)
+	}
+	end := off + len(lr.readbuf)
+
+	blocksize := int(lr.blocksize)
+	if end+blocksize > len(base) {
+		if len(lr.readbuf)+blocksize > len(base) {
+			base = make([]byte, max(2*len(base), len(lr.readbuf)+blocksize))
+		}
+		copy(base, lr.readbuf)
+		lr.readbufbase = base
+		off, end = 0, len(lr.readbuf)
+	}
+
+	var n int
+	if lr.idleFlush > 0 && end > off {
+		n, lr.readerErr = lr.ahead.ReadTimeout(base[end:end+blocksize], lr.idleFlush)
+		if lr.readerErr == readahead.ErrTimeout {
+			lr.readerErr = nil
+			timedOut = true
+		}
+	} else {
+		n, lr.readerErr = lr.reader.Read(base[end : end+blocksize])
+	}
+	lr.readbuf = base[off : end+n]
+	return
+}
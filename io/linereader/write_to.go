@@ -0,0 +1,122 @@
+package linereader
+
+import (
+	"bytes"
+	"io"
+)
+
+// LineTransform appends the output for line to out and returns the extended
+// slice. line does not include its newline. Returning out unchanged drops the
+// line. line is only valid for the duration of the call.
+type LineTransform func(out []byte, line []byte) []byte
+
+// CopyLine is the identity LineTransform.
+func CopyLine(out []byte, line []byte) []byte {
+	out = append(out, line...)
+	return append(out, '\n')
+}
+
+// WriteLinesTo passes every remaining line through transform and writes the
+// result to w. Lines that are entirely within a block are handed to transform
+// straight from the block buffer; only lines spanning blocks are assembled in
+// scratch. Every line longer than scratch is truncated to len(scratch), the
+// same way ReadExtra truncates lines longer than dst, and the binary policy
+// applies like it does to reads. Output is batched into writes of about one
+// block.
+//
+// It returns the number of bytes written and the number of bytes discarded
+// from truncated lines. Reaching EOF is not an error.
+func (lr *T) WriteLinesTo(w io.Writer, scratch []byte, transform LineTransform) (written int64, ndiscarded int, err error) {
+	if transform == nil {
+		transform = CopyLine
+	}
+	// lines pushed back by UnreadLine are written like any other
+	lr.unread = lr.unread[:0]
+
+	if lr.writebuf == nil {
+		lr.writebuf = make([]byte, 0, lr.blocksize)
+	}
+	out := lr.writebuf[:0]
+
+	flush := func() error {
+		if len(out) == 0 {
+			return nil
+		}
+		n, err := w.Write(out)
+		written += int64(n)
+		out = out[:0]
+		return err
+	}
+
+	// partial holds the beginning of a line that spans blocks
+	partial := scratch[:0]
+	inPartial := false
+
+	for {
+		if len(lr.readbuf) == 0 {
+			if lr.readerErr != nil {
+				break
+			}
+			var n int
+			n, lr.readerErr = lr.reader.Read(lr.readbufbase)
+			lr.readbuf = lr.readbufbase[:n]
+			continue
+		}
+
+		eolidx := bytes.IndexByte(lr.readbuf, '\n')
+		if eolidx < 0 {
+			// the line continues in the next block
+			n := copy(scratch[len(partial):], lr.readbuf)
+			partial = scratch[:len(partial)+n]
+			ndiscarded += len(lr.readbuf) - n
+			inPartial = true
+			lr.readbuf = lr.readbuf[len(lr.readbuf):]
+			continue
+		}
+
+		line := lr.readbuf[:eolidx]
+		lr.readbuf = lr.readbuf[eolidx+1:]
+		if inPartial {
+			n := copy(scratch[len(partial):], line)
+			ndiscarded += len(line) - n
+			line = scratch[:len(partial)+n]
+			partial = scratch[:0]
+			inPartial = false
+		} else if len(line) > len(scratch) {
+			ndiscarded += len(line) - len(scratch)
+			line = line[:len(scratch)]
+		}
+
+		line, dropped, keep := lr.binary.apply(line, len(scratch))
+		ndiscarded += dropped
+		if !keep {
+			continue
+		}
+		out = transform(out, line)
+		if len(out) >= int(lr.blocksize) {
+			if err = flush(); err != nil {
+				return
+			}
+		}
+	}
+
+	// the last line has no newline
+	if inPartial {
+		line, dropped, keep := lr.binary.apply(partial, len(scratch))
+		ndiscarded += dropped
+		if keep {
+			out = transform(out, line)
+		}
+	}
+	if err = flush(); err != nil {
+		return
+	}
+
+	// keep the batch buffer if transform grew it
+	lr.writebuf = out[:0]
+
+	if lr.readerErr != io.EOF {
+		err = lr.readerErr
+	}
+	return
+}
@@ -0,0 +1,167 @@
+// Package linesplit cuts a file into line-aligned byte ranges so that the
+// ranges can be scanned in parallel.
+package linesplit
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"sync"
+
+	"github.com/asymmetric-research/go-commons/io/linereader"
+	armath "github.com/asymmetric-research/go-commons/math"
+)
+
+// probeSize is how much is read at a time while looking for a newline near a
+// split point.
+const probeSize = 4096
+
+// checkEvery is how many lines are scanned between context checks.
+const checkEvery = 1024
+
+type Range struct {
+	Offset int64
+	Length int64
+}
+
+// Split cuts the first size bytes of r into at most n ranges. Every range but
+// the last ends right after a newline, so no line spans two ranges. Only the
+// bytes around each split point are read.
+func Split(r io.ReaderAt, size int64, n int) ([]Range, error) {
+	if n <= 0 {
+		return nil, errors.New("number of ranges must be greater than zero")
+	}
+
+	ranges := make([]Range, 0, n)
+	probe := make([]byte, probeSize)
+	start := int64(0)
+
+	for i := 1; i <= n && start < size; i++ {
+		end := size
+		if i < n {
+			target := armath.Max(start, size*int64(i)/int64(n))
+			var err error
+			end, err = nextLineStart(r, size, target, probe)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if end > start {
+			ranges = append(ranges, Range{Offset: start, Length: end - start})
+		}
+		start = end
+	}
+
+	return ranges, nil
+}
+
+// nextLineStart returns the offset of the first line starting at or after
+// target, or size if there is none.
+func nextLineStart(r io.ReaderAt, size, target int64, probe []byte) (int64, error) {
+	if target == 0 {
+		return 0, nil
+	}
+
+	// a line starts at target if the byte before it is a newline
+	for off := target - 1; off < size; off += int64(len(probe)) {
+		buf := probe[:armath.Min(int64(len(probe)), size-off)]
+		n, err := r.ReadAt(buf, off)
+		if idx := bytes.IndexByte(buf[:n], '\n'); idx >= 0 {
+			return off + int64(idx) + 1, nil
+		}
+		if err != nil && err != io.EOF {
+			return 0, err
+		}
+		if n < len(buf) {
+			break
+		}
+	}
+	return size, nil
+}
+
+// LineFunc is called for every line of a range. lineIdx is the index of the
+// line within its range, line is only valid for the duration of the call.
+type LineFunc func(rangeIdx int, lineIdx uint64, line []byte) error
+
+// Scan reads all ranges concurrently, each with its own linereader.T over an
+// io.SectionReader, and calls fn for every line. fn is called concurrently
+// for different ranges but sequentially within a range. Lines longer than
+// maxLineSize are truncated like linereader.T.ReadExtra truncates them.
+//
+// Scan returns the number of lines of every range. The first error returned
+// by fn or by r cancels the remaining ranges and is returned.
+func Scan(ctx context.Context, r io.ReaderAt, ranges []Range, blockSize uint, maxLineSize int, fn LineFunc) ([]uint64, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	counts := make([]uint64, len(ranges))
+
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+	)
+	fail := func(err error) {
+		errOnce.Do(func() {
+			firstErr = err
+			cancel()
+		})
+	}
+
+	for i, rng := range ranges {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := scanRange(ctx, r, i, rng, blockSize, maxLineSize, fn, &counts[i]); err != nil {
+				fail(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return counts, firstErr
+	}
+	return counts, ctx.Err()
+}
+
+func scanRange(ctx context.Context, r io.ReaderAt, rangeIdx int, rng Range, blockSize uint, maxLineSize int, fn LineFunc, count *uint64) error {
+	lr := linereader.T{}
+	linereader.NewInto(&lr, io.NewSectionReader(r, rng.Offset, rng.Length), blockSize)
+	line := make([]byte, maxLineSize)
+
+	for lineIdx := uint64(0); ; lineIdx++ {
+		if lineIdx%checkEvery == 0 {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+		}
+
+		n, _, err := lr.ReadExtra(line)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := fn(rangeIdx, lineIdx, line[:n]); err != nil {
+			return err
+		}
+		*count = lineIdx + 1
+	}
+}
+
+// FirstLines converts the per range line counts returned by Scan into the
+// global index of the first line of every range.
+func FirstLines(counts []uint64) []uint64 {
+	first := make([]uint64, len(counts))
+	total := uint64(0)
+	for i, cnt := range counts {
+		first[i] = total
+		total += cnt
+	}
+	return first
+}
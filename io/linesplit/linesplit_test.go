@@ -0,0 +1,107 @@
+package linesplit_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/asymmetric-research/go-commons/io/linesplit"
+	"github.com/stretchr/testify/require"
+)
+
+func makeLines(cnt int) []string {
+	lines := make([]string, cnt)
+	for i := range lines {
+		lines[i] = fmt.Sprintf("line %d %s", i, strings.Repeat("x", i%37))
+	}
+	return lines
+}
+
+func TestSplit(t *testing.T) {
+	data := strings.Join(makeLines(1000), "\n")
+	r := strings.NewReader(data)
+
+	for _, n := range []int{1, 2, 7, 64, 5000} {
+		ranges, err := linesplit.Split(r, int64(len(data)), n)
+		require.NoError(t, err)
+		require.LessOrEqual(t, len(ranges), n)
+
+		next := int64(0)
+		for i, rng := range ranges {
+			require.Equal(t, next, rng.Offset)
+			require.Positive(t, rng.Length)
+			if i != len(ranges)-1 {
+				require.Equal(t, byte('\n'), data[rng.Offset+rng.Length-1])
+			}
+			next = rng.Offset + rng.Length
+		}
+		require.Equal(t, int64(len(data)), next)
+	}
+}
+
+func TestSplitWithoutNewline(t *testing.T) {
+	data := strings.Repeat("x", 10000)
+	ranges, err := linesplit.Split(strings.NewReader(data), int64(len(data)), 4)
+	require.NoError(t, err)
+	require.Equal(t, []linesplit.Range{{Offset: 0, Length: 10000}}, ranges)
+
+	ranges, err = linesplit.Split(strings.NewReader(""), 0, 4)
+	require.NoError(t, err)
+	require.Empty(t, ranges)
+
+	_, err = linesplit.Split(strings.NewReader(data), int64(len(data)), 0)
+	require.Error(t, err)
+}
+
+func TestScan(t *testing.T) {
+	expected := makeLines(1000)
+	data := strings.Join(expected, "\n")
+	r := strings.NewReader(data)
+
+	ranges, err := linesplit.Split(r, int64(len(data)), 8)
+	require.NoError(t, err)
+
+	perRange := make([][]string, len(ranges))
+	var mu sync.Mutex
+	counts, err := linesplit.Scan(context.Background(), r, ranges, 4096, 4096, func(rangeIdx int, lineIdx uint64, line []byte) error {
+		mu.Lock()
+		defer mu.Unlock()
+		require.Equal(t, uint64(len(perRange[rangeIdx])), lineIdx)
+		perRange[rangeIdx] = append(perRange[rangeIdx], string(line))
+		return nil
+	})
+	require.NoError(t, err)
+
+	first := linesplit.FirstLines(counts)
+	got := make([]string, len(expected))
+	for i, lines := range perRange {
+		require.Equal(t, uint64(len(lines)), counts[i])
+		copy(got[first[i]:], lines)
+	}
+	require.Equal(t, expected, got)
+}
+
+func TestScanError(t *testing.T) {
+	data := strings.Join(makeLines(1000), "\n")
+	r := strings.NewReader(data)
+
+	ranges, err := linesplit.Split(r, int64(len(data)), 4)
+	require.NoError(t, err)
+
+	errStop := errors.New("stop")
+	_, err = linesplit.Scan(context.Background(), r, ranges, 4096, 4096, func(rangeIdx int, lineIdx uint64, line []byte) error {
+		if rangeIdx == 2 && lineIdx == 10 {
+			return errStop
+		}
+		return nil
+	})
+	require.ErrorIs(t, err, errStop)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = linesplit.Scan(ctx, r, ranges, 4096, 4096, func(int, uint64, []byte) error { return nil })
+	require.ErrorIs(t, err, context.Canceled)
+}
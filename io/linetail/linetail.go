@@ -0,0 +1,118 @@
+// Package linetail keeps the last lines of a stream, like tail(1), for
+// streams that can't be seeked such as pipes and subprocess output.
+package linetail
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/asymmetric-research/go-commons/collections/ringbuffer"
+	"github.com/asymmetric-research/go-commons/io/framer"
+)
+
+// span locates a line in the arena. start is an absolute write position, it
+// keeps growing as the arena wraps around.
+type span struct {
+	start  uint64
+	length uint64
+}
+
+// T keeps the last lines pushed to it, bounded both by a number of lines and
+// by a total byte budget. Line contents are stored in a shared byte arena, so
+// pushing a line does not allocate.
+type T struct {
+	arena []byte
+	// pos is the absolute position of the next write in the arena
+	pos   uint64
+	lines ringbuffer.T[span]
+}
+
+func New(nlines int, byteBudget int) (*T, error) {
+	ret := &T{}
+	return ret, NewInto(ret, nlines, make([]byte, byteBudget))
+}
+
+// NewInto keeps the last nlines lines, and at most len(arena) bytes of them.
+func NewInto(dst *T, nlines int, arena []byte) error {
+	if len(arena) <= 0 {
+		return fmt.Errorf("arena must have a greater than zero size")
+	}
+	*dst = T{arena: arena}
+	return ringbuffer.NewInto(&dst.lines, make([]span, nlines))
+}
+
+// Push stores a copy of line, evicting the oldest lines if needed. Lines
+// longer than the byte budget are truncated to it.
+func (t *T) Push(line []byte) {
+	arenalen := uint64(len(t.arena))
+	if uint64(len(line)) > arenalen {
+		line = line[:arenalen]
+	}
+
+	// lines are kept contiguous: if the line doesn't fit before the end of the
+	// arena, skip to its beginning.
+	off := t.pos % arenalen
+	if off+uint64(len(line)) > arenalen {
+		t.pos += arenalen - off
+		off = 0
+	}
+
+	copy(t.arena[off:], line)
+	t.lines.Push(span{start: t.pos, length: uint64(len(line))})
+	t.pos += uint64(len(line))
+}
+
+// evicted reports whether the bytes of s have been overwritten.
+func (t *T) evicted(s span) bool {
+	arenalen := uint64(len(t.arena))
+	return t.pos > arenalen && s.start < t.pos-arenalen
+}
+
+// Len returns the number of lines currently kept.
+func (t *T) Len() int {
+	cnt := 0
+	for range t.Seq() {
+		cnt++
+	}
+	return cnt
+}
+
+// Seq yields the kept lines oldest first. The yielded slices point into the
+// arena and are only valid until the next Push.
+func (t *T) Seq() func(yield func(int, []byte) bool) {
+	return func(yield func(int, []byte) bool) {
+		arenalen := uint64(len(t.arena))
+		i := 0
+		for _, s := range t.lines.Seq(ringbuffer.SEQ_MODE_FIFO) {
+			if t.evicted(s) {
+				continue
+			}
+			off := s.start % arenalen
+			if !yield(i, t.arena[off:off+s.length]) {
+				return
+			}
+			i++
+		}
+	}
+}
+
+// WriteTo writes the kept lines to w, oldest first, each followed by a newline.
+func (t *T) WriteTo(w io.Writer) (written int64, err error) {
+	newline := []byte{'\n'}
+	for _, line := range t.Seq() {
+		for _, b := range [][]byte{line, newline} {
+			var n int
+			n, err = w.Write(b)
+			written += int64(n)
+			if err != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+// Consume pushes every line of f, see framer.Each.
+func (t *T) Consume(f framer.Framer, line []byte) (ndiscarded int, err error) {
+	return framer.Each(f, line, t.Push)
+}
@@ -0,0 +1,92 @@
+package linetail_test
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/asymmetric-research/go-commons/io/linereader"
+	"github.com/asymmetric-research/go-commons/io/linetail"
+	"github.com/stretchr/testify/require"
+)
+
+func collect(t *linetail.T) []string {
+	var out []string
+	for i, line := range t.Seq() {
+		if i != len(out) {
+			panic("non contiguous index")
+		}
+		out = append(out, string(line))
+	}
+	return out
+}
+
+func TestTailByLines(t *testing.T) {
+	tail, err := linetail.New(3, 1024)
+	require.NoError(t, err)
+	require.Empty(t, collect(tail))
+
+	for i := range 10 {
+		tail.Push([]byte(fmt.Sprintf("line %d", i)))
+	}
+	require.Equal(t, []string{"line 7", "line 8", "line 9"}, collect(tail))
+	require.Equal(t, 3, tail.Len())
+}
+
+func TestTailByBytes(t *testing.T) {
+	tail, err := linetail.New(100, 16)
+	require.NoError(t, err)
+
+	for _, line := range []string{"aaaaa", "bbbbb", "ccccc", "ddddd"} {
+		tail.Push([]byte(line))
+	}
+	// ddddd doesn't fit after ccccc and wraps to the start, evicting aaaaa
+	require.Equal(t, []string{"bbbbb", "ccccc", "ddddd"}, collect(tail))
+
+	tail.Push([]byte("eeeeeeeeeee"))
+	require.Equal(t, []string{"ddddd", "eeeeeeeeeee"}, collect(tail))
+
+	tail.Push([]byte("this line is longer than the budget"))
+	require.Equal(t, []string{"this line is lon"}, collect(tail))
+
+	tail.Push(nil)
+	require.Equal(t, []string{"this line is lon", ""}, collect(tail))
+}
+
+func TestTailConsume(t *testing.T) {
+	lines := make([]string, 50)
+	for i := range lines {
+		lines[i] = fmt.Sprintf("line number %d", i)
+	}
+
+	tail, err := linetail.New(5, 4096)
+	require.NoError(t, err)
+	lr := linereader.New(strings.NewReader(strings.Join(lines, "\n")), 64)
+	discarded, err := tail.Consume(lr, make([]byte, 64))
+	require.NoError(t, err)
+	require.Zero(t, discarded)
+	require.Equal(t, lines[45:], collect(tail))
+
+	var out bytes.Buffer
+	_, err = tail.WriteTo(&out)
+	require.NoError(t, err)
+	require.Equal(t, strings.Join(lines[45:], "\n")+"\n", out.String())
+}
+
+func TestTailPushDoesNotAllocate(t *testing.T) {
+	tail, err := linetail.New(16, 256)
+	require.NoError(t, err)
+	line := []byte("some line of output")
+	allocs := testing.AllocsPerRun(100, func() {
+		tail.Push(line)
+	})
+	require.Zero(t, allocs)
+}
+
+func TestTailInvalid(t *testing.T) {
+	_, err := linetail.New(0, 16)
+	require.Error(t, err)
+	_, err = linetail.New(16, 0)
+	require.Error(t, err)
+}
@@ -0,0 +1,171 @@
+//go:build linux
+
+package mmaplines
+
+import (
+	"bytes"
+	"io"
+	"iter"
+	"math"
+	"os"
+	"runtime/debug"
+	"syscall"
+	"unsafe"
+
+	"github.com/asymmetric-research/go-commons/io/linereader"
+)
+
+// Open maps the file at path if it is a regular file. Other files, and files
+// that fail to map, are read with a linereader.T of blockSize.
+func Open(path string, blockSize uint) (Source, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if !info.Mode().IsRegular() || info.Size() > math.MaxInt {
+		return newFallback(f, blockSize), nil
+	}
+
+	m := &T{}
+	if info.Size() > 0 {
+		m.data, err = syscall.Mmap(int(f.Fd()), 0, int(info.Size()), syscall.PROT_READ, syscall.MAP_SHARED)
+		if err != nil {
+			return newFallback(f, blockSize), nil
+		}
+		// only a hint, a failure doesn't matter
+		_ = syscall.Madvise(m.data, syscall.MADV_SEQUENTIAL)
+	}
+
+	// the mapping stays valid once the file is closed
+	if err := f.Close(); err != nil {
+		m.Close()
+		return nil, err
+	}
+	return m, nil
+}
+
+var _ Source = (*T)(nil)
+
+// T yields the lines of a mapped file.
+//
+// If the file is truncated while mapped, accessing the missing pages raises
+// SIGBUS. Reads through T turn it into ErrFileTruncated, but slices yielded by
+// Lines must not be used once the file may have shrunk.
+type T struct {
+	data []byte
+	off  int
+}
+
+func (m *T) Read(dst []byte) (n int, err error) {
+	n, discarded, err := m.ReadExtra(dst)
+	if discarded != 0 {
+		return n, &linereader.ErrLineTruncated{Discarded: discarded}
+	}
+	return n, err
+}
+
+// ReadExtra copies the next line into dst like linereader.T.ReadExtra.
+func (m *T) ReadExtra(dst []byte) (nread int, ndiscarded int, err error) {
+	defer debug.SetPanicOnFault(debug.SetPanicOnFault(true))
+	defer m.recoverFault(&err)
+
+	line, err := m.next()
+	if err != nil {
+		return 0, 0, err
+	}
+	nread = copy(dst, line)
+	return nread, len(line) - nread, nil
+}
+
+// Lines yields the remaining lines straight from the mapping. Lines longer
+// than len(dst) are cut to it and yielded with an *linereader.ErrLineTruncated;
+// dst itself is never written.
+func (m *T) Lines(dst []byte) iter.Seq2[[]byte, error] {
+	return func(yield func([]byte, error) bool) {
+		for {
+			line, err := m.nextGuarded()
+			if err == io.EOF {
+				return
+			}
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+
+			if len(line) > len(dst) {
+				truncated := &linereader.ErrLineTruncated{Discarded: len(line) - len(dst)}
+				if !yield(line[:len(dst)], truncated) {
+					return
+				}
+				continue
+			}
+			if !yield(line, nil) {
+				return
+			}
+		}
+	}
+}
+
+// nextGuarded is next with faults turned into ErrFileTruncated. The loop body
+// of Lines runs outside of it: a panic there must not be swallowed.
+func (m *T) nextGuarded() (line []byte, err error) {
+	defer debug.SetPanicOnFault(debug.SetPanicOnFault(true))
+	defer m.recoverFault(&err)
+	return m.next()
+}
+
+func (m *T) next() ([]byte, error) {
+	if m.off >= len(m.data) {
+		return nil, io.EOF
+	}
+
+	rest := m.data[m.off:]
+	eolidx := bytes.IndexByte(rest, '\n')
+	if eolidx < 0 {
+		m.off = len(m.data)
+		return rest, nil
+	}
+	m.off += eolidx + 1
+	return rest[:eolidx], nil
+}
+
+// recoverFault turns a fault in the mapping into ErrFileTruncated. Callers
+// must enable debug.SetPanicOnFault, otherwise a fault crashes the process.
+func (m *T) recoverFault(err *error) {
+	r := recover()
+	if r == nil {
+		return
+	}
+
+	if fault, ok := r.(interface{ Addr() uintptr }); ok && m.inMapping(fault.Addr()) {
+		m.off = len(m.data)
+		*err = ErrFileTruncated
+		return
+	}
+	panic(r)
+}
+
+func (m *T) inMapping(addr uintptr) bool {
+	if len(m.data) == 0 {
+		return false
+	}
+	start := uintptr(unsafe.Pointer(unsafe.SliceData(m.data)))
+	return addr >= start && addr < start+uintptr(len(m.data))
+}
+
+// Close unmaps the file. Lines yielded before must not be used after it.
+func (m *T) Close() error {
+	if m.data == nil {
+		return nil
+	}
+	err := syscall.Munmap(m.data)
+	m.data = nil
+	m.off = 0
+	return err
+}
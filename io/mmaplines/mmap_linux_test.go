@@ -0,0 +1,80 @@
+//go:build linux
+
+package mmaplines_test
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/asymmetric-research/go-commons/io/mmaplines"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMapped(t *testing.T) {
+	s, err := mmaplines.Open(writeFile(t, "abc\n"), 64)
+	require.NoError(t, err)
+	defer s.Close()
+	require.IsType(t, &mmaplines.T{}, s)
+
+	// lines come from the mapping, dst is left alone
+	dst := make([]byte, 8)
+	for l := range s.Lines(dst) {
+		require.Equal(t, "abc", string(l))
+	}
+	require.Equal(t, make([]byte, 8), dst)
+}
+
+func TestFallbackFIFO(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fifo")
+	require.NoError(t, syscall.Mkfifo(path, 0o600))
+
+	go func() {
+		f, err := os.OpenFile(path, os.O_WRONLY, 0)
+		if err != nil {
+			return
+		}
+		f.WriteString("from\na pipe\n")
+		f.Close()
+	}()
+
+	s, err := mmaplines.Open(path, 64)
+	require.NoError(t, err)
+	_, mapped := s.(*mmaplines.T)
+	require.False(t, mapped)
+	require.Equal(t, []line{{"from", 0}, {"a pipe", 0}}, collect(t, s, make([]byte, 64)))
+	require.NoError(t, s.Close())
+}
+
+func TestTruncatedWhileMapped(t *testing.T) {
+	pagesize := os.Getpagesize()
+	content := make([]byte, 4*pagesize)
+	for i := range content {
+		content[i] = 'x'
+		if i%100 == 99 {
+			content[i] = '\n'
+		}
+	}
+	path := writeFile(t, string(content))
+
+	s, err := mmaplines.Open(path, 64)
+	require.NoError(t, err)
+	defer s.Close()
+
+	dst := make([]byte, 128)
+	_, _, err = s.ReadExtra(dst)
+	require.NoError(t, err)
+
+	require.NoError(t, os.Truncate(path, 0))
+
+	var lastErr error
+	for _, err := range s.Lines(dst) {
+		lastErr = err
+	}
+	require.ErrorIs(t, lastErr, mmaplines.ErrFileTruncated)
+
+	_, _, err = s.ReadExtra(dst)
+	require.ErrorIs(t, err, io.EOF)
+}
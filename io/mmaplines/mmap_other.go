@@ -0,0 +1,15 @@
+//go:build !linux
+
+package mmaplines
+
+import "os"
+
+// Open reads the file at path with a linereader.T of blockSize; files are only
+// mapped on linux.
+func Open(path string, blockSize uint) (Source, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return newFallback(f, blockSize), nil
+}
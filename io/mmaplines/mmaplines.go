@@ -0,0 +1,49 @@
+// Package mmaplines iterates over the lines of a regular file through a
+// memory mapping: lines are yielded straight from the mapping, without read
+// syscalls or copies. Other files fall back to a linereader.T.
+package mmaplines
+
+import (
+	"errors"
+	"iter"
+	"os"
+
+	"github.com/asymmetric-research/go-commons/io/framer"
+	"github.com/asymmetric-research/go-commons/io/linereader"
+)
+
+// ErrFileTruncated is returned when the mapped file shrank while being read.
+var ErrFileTruncated = errors.New("mapped file truncated while reading")
+
+// Source is the interface shared by mapped files and the linereader.T
+// fallback.
+type Source interface {
+	framer.Framer
+
+	// Lines iterates over the remaining lines like linereader.T.Lines does.
+	// len(dst) bounds the length of a line; a mapped file may yield slices of
+	// the mapping instead of dst.
+	Lines(dst []byte) iter.Seq2[[]byte, error]
+
+	Close() error
+}
+
+// fallback reads files that can't be mapped with a linereader.T.
+type fallback struct {
+	*linereader.T
+	f *os.File
+}
+
+func newFallback(f *os.File, blockSize uint) *fallback {
+	return &fallback{T: linereader.New(f, blockSize), f: f}
+}
+
+func (fb *fallback) Close() error {
+	err := fb.T.Close()
+	if ferr := fb.f.Close(); err == nil {
+		err = ferr
+	}
+	return err
+}
+
+var _ Source = (*fallback)(nil)
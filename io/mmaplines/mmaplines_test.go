@@ -0,0 +1,112 @@
+package mmaplines_test
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/asymmetric-research/go-commons/io/linereader"
+	"github.com/asymmetric-research/go-commons/io/mmaplines"
+	"github.com/stretchr/testify/require"
+)
+
+type line struct {
+	text      string
+	discarded int
+}
+
+func writeFile(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "lines")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	return path
+}
+
+func collect(t *testing.T, s mmaplines.Source, dst []byte) []line {
+	var out []line
+	for l, err := range s.Lines(dst) {
+		var truncated *linereader.ErrLineTruncated
+		discarded := 0
+		if errors.As(err, &truncated) {
+			discarded = truncated.Discarded
+		} else {
+			require.NoError(t, err)
+		}
+		out = append(out, line{string(l), discarded})
+	}
+	return out
+}
+
+func TestLines(t *testing.T) {
+	content := "one\n\nthree\na line that is too long\nlast"
+	path := writeFile(t, content)
+
+	s, err := mmaplines.Open(path, 64)
+	require.NoError(t, err)
+	defer s.Close()
+
+	expected := []line{{"one", 0}, {"", 0}, {"three", 0}, {"a line", 17}, {"last", 0}}
+	require.Equal(t, expected, collect(t, s, make([]byte, 6)))
+
+	// same interface, same lines as a linereader
+	lr := linereader.New(strings.NewReader(content), 64)
+	var fromReader []line
+	for l, err := range lr.Lines(make([]byte, 6)) {
+		var truncated *linereader.ErrLineTruncated
+		discarded := 0
+		if errors.As(err, &truncated) {
+			discarded = truncated.Discarded
+		}
+		fromReader = append(fromReader, line{string(l), discarded})
+	}
+	require.Equal(t, expected, fromReader)
+}
+
+func TestReadExtra(t *testing.T) {
+	path := writeFile(t, "short\nloooooong\n")
+
+	s, err := mmaplines.Open(path, 64)
+	require.NoError(t, err)
+	defer s.Close()
+
+	buf := make([]byte, 6)
+	n, discarded, err := s.ReadExtra(buf)
+	require.NoError(t, err)
+	require.Equal(t, "short", string(buf[:n]))
+	require.Zero(t, discarded)
+
+	n, err = s.Read(buf)
+	require.Equal(t, "looooo", string(buf[:n]))
+	require.Equal(t, &linereader.ErrLineTruncated{Discarded: 3}, err)
+
+	_, _, err = s.ReadExtra(buf)
+	require.Equal(t, io.EOF, err)
+}
+
+func TestEmpty(t *testing.T) {
+	s, err := mmaplines.Open(writeFile(t, ""), 64)
+	require.NoError(t, err)
+	require.Empty(t, collect(t, s, make([]byte, 8)))
+	require.NoError(t, s.Close())
+}
+
+func TestBreak(t *testing.T) {
+	s, err := mmaplines.Open(writeFile(t, "a\nb\nc\n"), 64)
+	require.NoError(t, err)
+	defer s.Close()
+
+	dst := make([]byte, 8)
+	for l := range s.Lines(dst) {
+		require.Equal(t, "a", string(l))
+		break
+	}
+	// iteration resumes after the last yielded line
+	require.Equal(t, []line{{"b", 0}, {"c", 0}}, collect(t, s, dst))
+}
+
+func TestOpenMissing(t *testing.T) {
+	_, err := mmaplines.Open(filepath.Join(t.TempDir(), "missing"), 64)
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
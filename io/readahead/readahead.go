@@ -0,0 +1,138 @@
+// Package readahead double buffers a reader: a background goroutine fills one
+// block while the consumer drains the other, so that slow reads and slow
+// consumers overlap.
+package readahead
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"time"
+)
+
+var (
+	ErrClosed  = errors.New("read-ahead reader closed")
+	ErrTimeout = errors.New("read-ahead read timed out")
+)
+
+type block struct {
+	buf []byte
+	n   int
+	err error
+}
+
+type T struct {
+	reader io.Reader
+
+	free   chan []byte
+	filled chan block
+	done   chan struct{}
+	closed sync.Once
+
+	// block being drained
+	cur    []byte
+	curbuf []byte
+	err    error
+}
+
+// New starts reading ahead from reader in blocks of blockSize bytes. Close
+// must be called to stop the background goroutine if the reader isn't read
+// until it returns an error.
+func New(reader io.Reader, blockSize uint) *T {
+	t := &T{
+		reader: reader,
+		free:   make(chan []byte, 2),
+		filled: make(chan block, 1),
+		done:   make(chan struct{}),
+	}
+	t.free <- make([]byte, blockSize)
+	t.free <- make([]byte, blockSize)
+
+	go t.run()
+	return t
+}
+
+func (t *T) run() {
+	defer close(t.filled)
+	for {
+		var buf []byte
+		select {
+		case buf = <-t.free:
+		case <-t.done:
+			return
+		}
+
+		n, err := t.reader.Read(buf)
+
+		select {
+		case t.filled <- block{buf: buf, n: n, err: err}:
+		case <-t.done:
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (t *T) Read(dst []byte) (n int, err error) {
+	return t.read(dst, nil)
+}
+
+// ReadTimeout is Read, but gives up with ErrTimeout if no data is available
+// within d. The data that arrives later is returned by the next read.
+func (t *T) ReadTimeout(dst []byte, d time.Duration) (n int, err error) {
+	if len(t.cur) > 0 {
+		return t.read(dst, nil)
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	return t.read(dst, timer.C)
+}
+
+func (t *T) read(dst []byte, timeout <-chan time.Time) (n int, err error) {
+	for len(t.cur) == 0 {
+		if t.curbuf != nil {
+			t.free <- t.curbuf
+			t.curbuf = nil
+		}
+		if t.err != nil {
+			return 0, t.err
+		}
+
+		var b block
+		var ok bool
+		select {
+		case b, ok = <-t.filled:
+		case <-t.done:
+			// a filled block may be queued too, select picks at random
+			select {
+			case b, ok = <-t.filled:
+			default:
+			}
+		case <-timeout:
+			return 0, ErrTimeout
+		}
+		if !ok {
+			t.err = ErrClosed
+			return 0, t.err
+		}
+		t.cur = b.buf[:b.n]
+		t.curbuf = b.buf
+		t.err = b.err
+	}
+
+	n = copy(dst, t.cur)
+	t.cur = t.cur[n:]
+	return n, nil
+}
+
+// Close stops reading ahead. A read of the underlying reader that is already
+// in progress can't be interrupted; the goroutine exits once it returns.
+// Reads after Close return ErrClosed once buffered data is drained.
+func (t *T) Close() error {
+	t.closed.Do(func() {
+		close(t.done)
+	})
+	return nil
+}
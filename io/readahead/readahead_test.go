@@ -0,0 +1,111 @@
+package readahead_test
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/asymmetric-research/go-commons/io/readahead"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadAhead(t *testing.T) {
+	data := strings.Repeat("some data to read ahead\n", 1000)
+	for _, r := range []io.Reader{
+		strings.NewReader(data),
+		iotest.OneByteReader(strings.NewReader(data)),
+		iotest.DataErrReader(strings.NewReader(data)),
+	} {
+		ra := readahead.New(r, 64)
+		out, err := io.ReadAll(iotest.HalfReader(ra))
+		require.NoError(t, err)
+		require.Equal(t, data, string(out))
+		require.NoError(t, ra.Close())
+	}
+}
+
+func TestReadAheadError(t *testing.T) {
+	errBroken := errors.New("broken")
+	ra := readahead.New(io.MultiReader(strings.NewReader("data"), iotest.ErrReader(errBroken)), 64)
+	out, err := io.ReadAll(ra)
+	require.ErrorIs(t, err, errBroken)
+	require.Equal(t, "data", string(out))
+
+	_, err = ra.Read(make([]byte, 8))
+	require.ErrorIs(t, err, errBroken)
+}
+
+func TestReadAheadClose(t *testing.T) {
+	// the background goroutine is blocked in Read, Close must not wait for it
+	pr, pw := io.Pipe()
+	defer pw.Close()
+
+	ra := readahead.New(pr, 64)
+	require.NoError(t, ra.Close())
+	_, err := ra.Read(make([]byte, 8))
+	require.ErrorIs(t, err, readahead.ErrClosed)
+
+	require.NoError(t, ra.Close())
+}
+
+func TestReadAheadCloseDrainsFilled(t *testing.T) {
+	pr, pw := io.Pipe()
+	defer pw.Close()
+
+	ra := readahead.New(pr, 4)
+	_, err := pw.Write([]byte("abcd"))
+	require.NoError(t, err)
+	// the second block is only read once the first one is queued
+	_, err = pw.Write([]byte("ef"))
+	require.NoError(t, err)
+	require.NoError(t, ra.Close())
+
+	buf := make([]byte, 8)
+	n, err := ra.Read(buf)
+	require.NoError(t, err)
+	require.Equal(t, "abcd", string(buf[:n]))
+}
+
+func TestReadAheadPipe(t *testing.T) {
+	pr, pw := io.Pipe()
+	ra := readahead.New(pr, 4)
+	defer ra.Close()
+
+	go func() {
+		pw.Write([]byte("abcd"))
+		pw.Write([]byte("efgh"))
+		pw.Close()
+	}()
+
+	buf := make([]byte, 2)
+	_, err := io.ReadFull(ra, buf)
+	require.NoError(t, err)
+	require.Equal(t, "ab", string(buf))
+
+	rest, err := io.ReadAll(ra)
+	require.NoError(t, err)
+	require.Equal(t, "cdefgh", string(rest))
+}
+
+func TestReadTimeout(t *testing.T) {
+	pr, pw := io.Pipe()
+	ra := readahead.New(pr, 8)
+	defer ra.Close()
+
+	buf := make([]byte, 8)
+	_, err := ra.ReadTimeout(buf, 10*time.Millisecond)
+	require.Equal(t, readahead.ErrTimeout, err)
+
+	go pw.Write([]byte("late"))
+
+	n, err := ra.ReadTimeout(buf, time.Minute)
+	require.NoError(t, err)
+	require.Equal(t, "late", string(buf[:n]))
+
+	pw.Close()
+	_, err = ra.ReadTimeout(buf, time.Minute)
+	require.Equal(t, io.EOF, err)
+}
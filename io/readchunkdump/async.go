@@ -0,0 +1,221 @@
+package readchunkdump
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type OverflowPolicy int
+
+const (
+	// OVERFLOW_POLICY_DROP doesn't record a call when the queue is full. The
+	// replay of the recording fails with ErrDropped where calls are missing.
+	OVERFLOW_POLICY_DROP OverflowPolicy = iota
+	// OVERFLOW_POLICY_BLOCK makes Read wait for room in the queue
+	OVERFLOW_POLICY_BLOCK
+)
+
+func (p OverflowPolicy) String() string {
+	switch p {
+	case OVERFLOW_POLICY_DROP:
+		return "drop"
+	case OVERFLOW_POLICY_BLOCK:
+		return "block"
+	}
+	return "OverflowPolicy(" + strconv.Itoa(int(p)) + ")"
+}
+
+type AsyncConfig struct {
+	// QueueSize is the number of calls waiting to be written, 64 if 0
+	QueueSize int
+	Overflow  OverflowPolicy
+
+	// MaxBytes and MaxChunks stop the recording once the recorded chunks would
+	// go over them, 0 means no limit. The recording keeps the chunks before.
+	MaxBytes  int64
+	MaxChunks int
+
+	// OnError, if set, is called from the writing goroutine with the error
+	// that stopped the recording. Close returns it either way.
+	OnError func(error)
+}
+
+// AsyncRecorder is FileRecorder writing from a background goroutine: Read
+// copies the chunk into a bounded queue and returns. It never panics, the
+// first write error stops the recording and the reads go on unrecorded.
+//
+// Close must be called, and not concurrently with Read.
+type AsyncRecorder struct {
+	r   io.Reader
+	cfg AsyncConfig
+	rf  recordingFile
+
+	queue chan asyncCall
+	done  sync.WaitGroup
+
+	// accessed by Read only
+	start   time.Time
+	chunks  int
+	size    int64
+	dropped int
+	pending int
+	capped  bool
+	closed  bool
+
+	failed   atomic.Bool
+	err      error
+	closeErr error
+}
+
+type asyncCall struct {
+	at      time.Duration
+	data    []byte
+	err     error
+	bufSize int
+	// dropped is the number of calls dropped before this one
+	dropped int
+}
+
+func NewAsyncRecorder(r io.Reader, w io.Writer, cfg AsyncConfig, opts ...RecordOption) (*AsyncRecorder, error) {
+	ar := newAsyncRecorder(r, cfg)
+	if err := ar.rf.init(w, KIND_READS, ar.manifest(opts)); err != nil {
+		return nil, err
+	}
+	ar.run()
+	return ar, nil
+}
+
+// CreateAsyncRecorder records into a new file at path.
+func CreateAsyncRecorder(r io.Reader, path string, cfg AsyncConfig, opts ...RecordOption) (*AsyncRecorder, error) {
+	ar := newAsyncRecorder(r, cfg)
+	if err := ar.rf.create(path, KIND_READS, ar.manifest(opts)); err != nil {
+		return nil, err
+	}
+	ar.run()
+	return ar, nil
+}
+
+func newAsyncRecorder(r io.Reader, cfg AsyncConfig) *AsyncRecorder {
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = 64
+	}
+	return &AsyncRecorder{
+		r:     r,
+		cfg:   cfg,
+		queue: make(chan asyncCall, cfg.QueueSize),
+	}
+}
+
+func (ar *AsyncRecorder) manifest(opts []RecordOption) Manifest {
+	return newManifest(opts, map[string]string{
+		"recorder":   "readchunkdump.AsyncRecorder",
+		"queue_size": strconv.Itoa(ar.cfg.QueueSize),
+		"overflow":   ar.cfg.Overflow.String(),
+		"max_bytes":  strconv.FormatInt(ar.cfg.MaxBytes, 10),
+		"max_chunks": strconv.Itoa(ar.cfg.MaxChunks),
+	})
+}
+
+func (ar *AsyncRecorder) run() {
+	ar.start = ar.rf.start
+	ar.done.Add(1)
+	go func() {
+		defer ar.done.Done()
+		for call := range ar.queue {
+			if ar.err != nil {
+				continue
+			}
+			if err := ar.write(call); err != nil {
+				ar.err = err
+				ar.failed.Store(true)
+				if ar.cfg.OnError != nil {
+					ar.cfg.OnError(err)
+				}
+			}
+		}
+	}()
+}
+
+func (ar *AsyncRecorder) write(call asyncCall) error {
+	if call.dropped > 0 {
+		if err := ar.rf.rw.writeDropped(call.dropped); err != nil {
+			return err
+		}
+	}
+	return ar.rf.rw.writeCall(call.at, call.data, call.err, call.bufSize)
+}
+
+func (ar *AsyncRecorder) Read(in []byte) (n int, err error) {
+	n, err = ar.r.Read(in)
+	if ar.capped || ar.closed || ar.failed.Load() {
+		return
+	}
+
+	if (ar.cfg.MaxChunks > 0 && ar.chunks+1 > ar.cfg.MaxChunks) ||
+		(ar.cfg.MaxBytes > 0 && ar.size+int64(n) > ar.cfg.MaxBytes) {
+		ar.capped = true
+		return
+	}
+
+	call := asyncCall{
+		at:      time.Since(ar.start),
+		data:    bytes.Clone(in[:n]),
+		err:     err,
+		bufSize: len(in),
+		dropped: ar.pending,
+	}
+	if ar.cfg.Overflow == OVERFLOW_POLICY_BLOCK {
+		ar.queue <- call
+	} else {
+		select {
+		case ar.queue <- call:
+		default:
+			ar.pending++
+			ar.dropped++
+			return
+		}
+	}
+	ar.pending = 0
+	ar.chunks++
+	ar.size += int64(n)
+	return
+}
+
+// Close waits for the queued calls to be written, then writes the manifest
+// and the index. It returns the error that stopped the recording, if any. It
+// doesn't close r.
+func (ar *AsyncRecorder) Close() error {
+	if ar.closed {
+		return ar.closeErr
+	}
+	ar.closed = true
+	close(ar.queue)
+	ar.done.Wait()
+
+	ar.closeErr = ar.finish()
+	return ar.closeErr
+}
+
+func (ar *AsyncRecorder) finish() error {
+	rw := ar.rf.rw
+	err := ar.err
+	if err == nil && ar.pending > 0 {
+		// calls dropped at the end
+		err = rw.writeDropped(ar.pending)
+	}
+	if err != nil {
+		if ar.rf.closer != nil {
+			ar.rf.closer.Close()
+		}
+		return fmt.Errorf("recording stopped: %w", err)
+	}
+
+	rw.manifest.Dropped = ar.dropped
+	rw.manifest.Capped = ar.capped
+	return ar.rf.Close()
+}
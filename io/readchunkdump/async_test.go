@@ -0,0 +1,171 @@
+package readchunkdump_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/asymmetric-research/go-commons/io/readchunkdump"
+	"github.com/stretchr/testify/require"
+)
+
+// gatedWriter blocks writes once armed, until gate is closed, and fails them
+// if err is set.
+type gatedWriter struct {
+	bytes.Buffer
+	armed atomic.Bool
+	gate  chan struct{}
+	err   error
+}
+
+func newGatedWriter() *gatedWriter {
+	return &gatedWriter{gate: make(chan struct{})}
+}
+
+func (w *gatedWriter) Write(p []byte) (int, error) {
+	if w.armed.Load() {
+		<-w.gate
+		if w.err != nil {
+			return 0, w.err
+		}
+	}
+	return w.Buffer.Write(p)
+}
+
+func (w *gatedWriter) save(t *testing.T) string {
+	path := filepath.Join(t.TempDir(), "recording")
+	require.NoError(t, os.WriteFile(path, w.Bytes(), 0o644))
+	return path
+}
+
+func manyChunks(n int) []string {
+	out := make([]string, n)
+	for i := range out {
+		out[i] = string(rune('a'+i)) + "\n"
+	}
+	return out
+}
+
+func TestAsyncRecorder(t *testing.T) {
+	w := newGatedWriter()
+	ar, err := readchunkdump.NewAsyncRecorder(&chunkReader{chunks: chunks}, w, readchunkdump.AsyncConfig{}, readchunkdump.WithSource("async"))
+	require.NoError(t, err)
+	drain(t, ar)
+	require.NoError(t, ar.Close())
+	require.NoError(t, ar.Close())
+
+	path := w.save(t)
+	require.Equal(t, chunks, replay(t, path))
+
+	r, err := readchunkdump.NewReplayer(path)
+	require.NoError(t, err)
+	defer r.Close()
+	m := r.Manifest()
+	require.Equal(t, "async", m.Source)
+	require.Equal(t, "64", m.Settings["queue_size"])
+	require.Equal(t, "drop", m.Settings["overflow"])
+	require.Zero(t, m.Dropped)
+	require.False(t, m.Capped)
+}
+
+func TestAsyncRecorderDrop(t *testing.T) {
+	w := newGatedWriter()
+	src := manyChunks(10)
+	ar, err := readchunkdump.NewAsyncRecorder(&chunkReader{chunks: src}, w, readchunkdump.AsyncConfig{QueueSize: 1})
+	require.NoError(t, err)
+
+	// reads aren't held up by the stuck writer
+	w.armed.Store(true)
+	data, err := io.ReadAll(ar)
+	require.NoError(t, err)
+	require.Equal(t, len(src)*2, len(data))
+
+	close(w.gate)
+	require.NoError(t, ar.Close())
+
+	r, err := readchunkdump.NewReplayer(w.save(t))
+	require.NoError(t, err)
+	defer r.Close()
+	m := r.Manifest()
+	require.Positive(t, m.Dropped)
+	require.Equal(t, len(src)+1, m.ChunkCount+m.Dropped)
+
+	_, err = io.ReadAll(r)
+	require.ErrorIs(t, err, readchunkdump.ErrDropped)
+}
+
+func TestAsyncRecorderBlock(t *testing.T) {
+	w := newGatedWriter()
+	src := manyChunks(10)
+	ar, err := readchunkdump.NewAsyncRecorder(&chunkReader{chunks: src}, w, readchunkdump.AsyncConfig{
+		QueueSize: 1,
+		Overflow:  readchunkdump.OVERFLOW_POLICY_BLOCK,
+	})
+	require.NoError(t, err)
+
+	w.armed.Store(true)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		drain(t, ar)
+	}()
+	close(w.gate)
+	<-done
+	require.NoError(t, ar.Close())
+
+	require.Equal(t, src, replay(t, w.save(t)))
+}
+
+func TestAsyncRecorderCaps(t *testing.T) {
+	for _, tc := range []struct {
+		cfg      readchunkdump.AsyncConfig
+		expected []string
+	}{
+		{readchunkdump.AsyncConfig{MaxChunks: 2}, chunks[:2]},
+		{readchunkdump.AsyncConfig{MaxBytes: 20}, chunks[:1]},
+		{readchunkdump.AsyncConfig{MaxBytes: 23}, chunks[:3]},
+	} {
+		w := newGatedWriter()
+		ar, err := readchunkdump.NewAsyncRecorder(&chunkReader{chunks: chunks}, w, tc.cfg)
+		require.NoError(t, err)
+		data, err := io.ReadAll(ar)
+		require.NoError(t, err)
+		require.Equal(t, strings.Join(chunks, ""), string(data))
+		require.NoError(t, ar.Close())
+
+		path := w.save(t)
+		require.Equal(t, tc.expected, replay(t, path))
+		r, err := readchunkdump.NewReplayer(path)
+		require.NoError(t, err)
+		require.True(t, r.Manifest().Capped)
+		require.NoError(t, r.Close())
+	}
+}
+
+func TestAsyncRecorderError(t *testing.T) {
+	errFull := errors.New("disk full")
+	w := newGatedWriter()
+	w.err = errFull
+	close(w.gate)
+
+	var reported []error
+	ar, err := readchunkdump.NewAsyncRecorder(&chunkReader{chunks: chunks}, w, readchunkdump.AsyncConfig{
+		Overflow: readchunkdump.OVERFLOW_POLICY_BLOCK,
+		OnError:  func(err error) { reported = append(reported, err) },
+	})
+	require.NoError(t, err)
+	w.armed.Store(true)
+
+	data, err := io.ReadAll(ar)
+	require.NoError(t, err)
+	require.Equal(t, strings.Join(chunks, ""), string(data))
+
+	err = ar.Close()
+	require.ErrorIs(t, err, errFull)
+	require.Equal(t, []error{errFull}, reported)
+}
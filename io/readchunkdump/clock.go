@@ -0,0 +1,43 @@
+package readchunkdump
+
+import "time"
+
+// Clock paces a timed replay.
+type Clock interface {
+	// Now returns the time elapsed since an arbitrary fixed point.
+	Now() time.Duration
+	Sleep(d time.Duration)
+}
+
+type realClock struct {
+	start time.Time
+}
+
+func (c realClock) Now() time.Duration {
+	return time.Since(c.start)
+}
+
+func (c realClock) Sleep(d time.Duration) {
+	time.Sleep(d)
+}
+
+// VirtualClock is a Clock that only moves when it sleeps or is advanced, to
+// keep timed replays deterministic in tests. The zero value is ready to use.
+type VirtualClock struct {
+	now time.Duration
+}
+
+func (c *VirtualClock) Now() time.Duration {
+	return c.now
+}
+
+func (c *VirtualClock) Sleep(d time.Duration) {
+	c.Advance(d)
+}
+
+// Advance moves the clock forward by d, as time spent by the consumer.
+func (c *VirtualClock) Advance(d time.Duration) {
+	if d > 0 {
+		c.now += d
+	}
+}
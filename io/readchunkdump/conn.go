@@ -0,0 +1,390 @@
+package readchunkdump
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// ConnRecorder records both directions of a connection: the Read and Write
+// calls are written to one recording, the reads in the order they return and
+// the writes in the order they start, so that a response read by one
+// goroutine always comes after the request written by another. It wraps any
+// io.ReadWriter; the net.Conn methods go to the wrapped value if it is a
+// net.Conn. Like FileRecorder, the first recording error stops the recording
+// and is returned by Close.
+type ConnRecorder struct {
+	rw io.ReadWriter
+
+	mu     sync.Mutex
+	rf     recordingFile
+	closed bool
+
+	// seq is the slot of the next call, flushed the slot of the next call to
+	// write, and pending the calls that returned before the ones ahead of them
+	seq     uint64
+	flushed uint64
+	pending map[uint64]connCall
+}
+
+// connCall is a call to write into its slot of the recording.
+type connCall struct {
+	seq       uint64
+	at        time.Duration
+	direction byte
+	data      []byte
+	err       error
+	bufSize   int
+}
+
+var _ net.Conn = (*ConnRecorder)(nil)
+
+func NewConnRecorder(rw io.ReadWriter, out io.Writer, opts ...RecordOption) (*ConnRecorder, error) {
+	c := &ConnRecorder{rw: rw, pending: map[uint64]connCall{}}
+	return c, c.rf.init(out, KIND_CONVERSATION, c.manifest(opts))
+}
+
+// CreateConnRecorder records into a new file at path.
+func CreateConnRecorder(rw io.ReadWriter, path string, opts ...RecordOption) (*ConnRecorder, error) {
+	c := &ConnRecorder{rw: rw, pending: map[uint64]connCall{}}
+	return c, c.rf.create(path, KIND_CONVERSATION, c.manifest(opts))
+}
+
+func (c *ConnRecorder) manifest(opts []RecordOption) Manifest {
+	return newManifest(opts, map[string]string{"recorder": "readchunkdump.ConnRecorder"})
+}
+
+func (c *ConnRecorder) Read(in []byte) (n int, err error) {
+	n, err = c.rw.Read(in)
+	call := c.reserve(directionRead)
+	call.data, call.err, call.bufSize = in[:n], err, len(in)
+	c.record(call)
+	return
+}
+
+func (c *ConnRecorder) Write(p []byte) (n int, err error) {
+	// the slot is taken before the peer can see the bytes
+	call := c.reserve(directionWrite)
+	n, err = c.rw.Write(p)
+	call.data, call.err, call.bufSize = p[:n], err, -1
+	c.record(call)
+	return
+}
+
+// reserve takes the next slot of the recording.
+func (c *ConnRecorder) reserve(direction byte) connCall {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	call := connCall{seq: c.seq, at: time.Since(c.rf.start), direction: direction}
+	c.seq++
+	return call
+}
+
+// record writes call once the calls of the slots before it are written.
+func (c *ConnRecorder) record(call connCall) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if call.seq != c.flushed {
+		// the caller may reuse its buffer once the call returns
+		call.data = bytes.Clone(call.data)
+		c.pending[call.seq] = call
+		return
+	}
+	for {
+		c.write(call)
+		c.flushed++
+
+		var ok bool
+		if call, ok = c.pending[c.flushed]; !ok {
+			return
+		}
+		delete(c.pending, c.flushed)
+	}
+}
+
+func (c *ConnRecorder) write(call connCall) {
+	if c.rf.err != nil || c.closed {
+		return
+	}
+	c.rf.err = c.rf.rw.writeRecord(tagDirection, []byte{call.direction})
+	if c.rf.err == nil {
+		c.rf.err = c.rf.rw.writeCall(call.at, call.data, call.err, call.bufSize)
+	}
+}
+
+// Close closes the wrapped value if it is an io.Closer, and finishes the
+// recording.
+func (c *ConnRecorder) Close() error {
+	var err error
+	if closer, ok := c.rw.(io.Closer); ok {
+		err = closer.Close()
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return err
+	}
+	c.closed = true
+	return errors.Join(err, c.rf.Close())
+}
+
+func (c *ConnRecorder) LocalAddr() net.Addr {
+	if conn, ok := c.rw.(net.Conn); ok {
+		return conn.LocalAddr()
+	}
+	return replayAddr{}
+}
+
+func (c *ConnRecorder) RemoteAddr() net.Addr {
+	if conn, ok := c.rw.(net.Conn); ok {
+		return conn.RemoteAddr()
+	}
+	return replayAddr{}
+}
+
+func (c *ConnRecorder) SetDeadline(t time.Time) error {
+	if conn, ok := c.rw.(net.Conn); ok {
+		return conn.SetDeadline(t)
+	}
+	return os.ErrNoDeadline
+}
+
+func (c *ConnRecorder) SetReadDeadline(t time.Time) error {
+	if conn, ok := c.rw.(net.Conn); ok {
+		return conn.SetReadDeadline(t)
+	}
+	return os.ErrNoDeadline
+}
+
+func (c *ConnRecorder) SetWriteDeadline(t time.Time) error {
+	if conn, ok := c.rw.(net.Conn); ok {
+		return conn.SetWriteDeadline(t)
+	}
+	return os.ErrNoDeadline
+}
+
+type replayAddr struct{}
+
+func (replayAddr) Network() string { return "readchunkdump" }
+func (replayAddr) String() string  { return "replay" }
+
+// ErrWriteMismatch is returned by the Write calls of a ConnReplayer that
+// differ from the recorded client bytes.
+var ErrWriteMismatch = errors.New("write doesn't match the recording")
+
+// ConnReplayer is a fake net.Conn serving a recorded conversation to the
+// client under test. Reads return the recorded server chunks, each one only
+// once the client has written all the bytes it wrote before that chunk in the
+// recording: a Read waits for them until the read deadline or Close. Writes
+// are compared to the recorded client bytes, the way the client splits them
+// into calls doesn't matter. See WithWriteRecording to accept any writes.
+type ConnReplayer struct {
+	mu   sync.Mutex
+	cond *sync.Cond
+
+	reads []connRead
+	// client holds the recorded client bytes
+	client []byte
+	// written is the number of bytes written by the client
+	written int
+
+	recordWrites bool
+	writes       bytes.Buffer
+
+	rest     []byte
+	restErr  error
+	closed   bool
+	deadline time.Time
+}
+
+var _ net.Conn = (*ConnReplayer)(nil)
+
+type connRead struct {
+	chunk
+	// after is the number of client bytes written before the read
+	after int
+}
+
+type ConnOption func(*ConnReplayer)
+
+// WithWriteRecording accepts any writes instead of comparing them to the
+// recording, and keeps them for Written. Reads still wait for as many bytes
+// as were recorded before them.
+func WithWriteRecording() ConnOption {
+	return func(c *ConnReplayer) {
+		c.recordWrites = true
+	}
+}
+
+func NewConnReplayer(recording string, opts ...ConnOption) (*ConnReplayer, error) {
+	fsys, name := osPath(recording)
+	return NewConnReplayerFS(fsys, name, opts...)
+}
+
+// NewConnReplayerFS replays the conversation root of fsys. Other recordings
+// are rejected with a *KindError.
+func NewConnReplayerFS(fsys fs.FS, root string, opts ...ConnOption) (*ConnReplayer, error) {
+	src, err := openSource(fsys, root, KIND_CONVERSATION)
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	c := &ConnReplayer{}
+	c.cond = sync.NewCond(&c.mu)
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	for {
+		call, err := src.next()
+		if err == io.EOF {
+			return c, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if call.write {
+			c.client = append(c.client, call.data...)
+		} else {
+			c.reads = append(c.reads, connRead{chunk: call, after: len(c.client)})
+		}
+	}
+}
+
+func (c *ConnReplayer) Read(dst []byte) (n int, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return 0, net.ErrClosed
+	}
+	if len(c.rest) == 0 {
+		if len(c.reads) == 0 {
+			return 0, io.EOF
+		}
+		if err := c.waitWritten(c.reads[0].after); err != nil {
+			return 0, err
+		}
+		c.rest, c.restErr = c.reads[0].data, c.reads[0].err
+		c.reads = c.reads[1:]
+	}
+
+	n = copy(dst, c.rest)
+	c.rest = c.rest[n:]
+	if len(c.rest) > 0 {
+		return n, nil
+	}
+	return n, c.restErr
+}
+
+// waitWritten waits until the client has written count bytes.
+func (c *ConnReplayer) waitWritten(count int) error {
+	var timer *time.Timer
+	defer func() {
+		if timer != nil {
+			timer.Stop()
+		}
+	}()
+
+	for c.written < count {
+		if c.closed {
+			return net.ErrClosed
+		}
+		if !c.deadline.IsZero() {
+			wait := time.Until(c.deadline)
+			if wait <= 0 {
+				return os.ErrDeadlineExceeded
+			}
+			// the deadline may have moved since the last wait
+			if timer != nil {
+				timer.Stop()
+			}
+			timer = time.AfterFunc(wait, func() {
+				c.mu.Lock()
+				defer c.mu.Unlock()
+				c.cond.Broadcast()
+			})
+		}
+		c.cond.Wait()
+	}
+	return nil
+}
+
+func (c *ConnReplayer) Write(p []byte) (n int, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	defer c.cond.Broadcast()
+
+	if c.closed {
+		return 0, net.ErrClosed
+	}
+	if c.recordWrites {
+		c.writes.Write(p)
+		c.written += len(p)
+		return len(p), nil
+	}
+
+	base, expected := c.written, c.client[c.written:]
+	for n < len(p) {
+		if n == len(expected) {
+			return n, fmt.Errorf("%w: %d bytes written past the %d recorded", ErrWriteMismatch, len(p)-n, len(c.client))
+		}
+		if p[n] != expected[n] {
+			return n, fmt.Errorf("%w: byte %d is %q, expected %q", ErrWriteMismatch, base+n, p[n], expected[n])
+		}
+		n++
+		c.written++
+	}
+	return n, nil
+}
+
+// Written returns the bytes written by the client with WithWriteRecording.
+func (c *ConnReplayer) Written() []byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return bytes.Clone(c.writes.Bytes())
+}
+
+// Done reports whether the client read and wrote the whole conversation.
+func (c *ConnReplayer) Done() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.reads) == 0 && len(c.rest) == 0 && c.written >= len(c.client)
+}
+
+func (c *ConnReplayer) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	c.cond.Broadcast()
+	return nil
+}
+
+func (c *ConnReplayer) LocalAddr() net.Addr  { return replayAddr{} }
+func (c *ConnReplayer) RemoteAddr() net.Addr { return replayAddr{} }
+
+func (c *ConnReplayer) SetDeadline(t time.Time) error {
+	return c.SetReadDeadline(t)
+}
+
+func (c *ConnReplayer) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.deadline = t
+	c.cond.Broadcast()
+	return nil
+}
+
+// SetWriteDeadline does nothing, writes never block.
+func (c *ConnReplayer) SetWriteDeadline(t time.Time) error {
+	return nil
+}
@@ -0,0 +1,257 @@
+package readchunkdump_test
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/asymmetric-research/go-commons/io/readchunkdump"
+	"github.com/stretchr/testify/require"
+)
+
+// serve answers each request line with a response split over two writes.
+func serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		req, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		name := strings.TrimSpace(strings.TrimPrefix(req, "GET "))
+		conn.Write([]byte("value of "))
+		conn.Write([]byte(name + "\n"))
+	}
+}
+
+func client(conn net.Conn, names ...string) ([]string, error) {
+	r := bufio.NewReader(conn)
+	var out []string
+	for _, name := range names {
+		if _, err := fmt.Fprintf(conn, "GET %s\n", name); err != nil {
+			return out, err
+		}
+		resp, err := r.ReadString('\n')
+		if err != nil {
+			return out, err
+		}
+		out = append(out, resp)
+	}
+	return out, nil
+}
+
+func recordConversation(t *testing.T) string {
+	clientConn, serverConn := net.Pipe()
+	go serve(serverConn)
+
+	path := filepath.Join(t.TempDir(), "conversation")
+	rec, err := readchunkdump.CreateConnRecorder(clientConn, path, readchunkdump.WithSource("pipe"))
+	require.NoError(t, err)
+
+	out, err := client(rec, "a", "b")
+	require.NoError(t, err)
+	require.Equal(t, []string{"value of a\n", "value of b\n"}, out)
+	require.NoError(t, rec.Close())
+	return path
+}
+
+func TestConnReplay(t *testing.T) {
+	path := recordConversation(t)
+
+	conn, err := readchunkdump.NewConnReplayer(path)
+	require.NoError(t, err)
+	out, err := client(conn, "a", "b")
+	require.NoError(t, err)
+	require.Equal(t, []string{"value of a\n", "value of b\n"}, out)
+	require.True(t, conn.Done())
+	require.NoError(t, conn.Close())
+
+	// read as a plain recording, only the server side is left
+	r, err := readchunkdump.NewReplayer(path)
+	require.NoError(t, err)
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.Equal(t, "value of a\nvalue of b\n", string(data))
+}
+
+func TestConnReplayInterleaving(t *testing.T) {
+	conn, err := readchunkdump.NewConnReplayer(recordConversation(t))
+	require.NoError(t, err)
+	defer conn.Close()
+
+	// the response isn't served before the request is written
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(10*time.Millisecond)))
+	_, err = conn.Read(make([]byte, 64))
+	require.ErrorIs(t, err, os.ErrDeadlineExceeded)
+	require.NoError(t, conn.SetReadDeadline(time.Time{}))
+
+	read := make(chan string)
+	go func() {
+		buf := make([]byte, 64)
+		n, _ := conn.Read(buf)
+		read <- string(buf[:n])
+	}()
+
+	// writes can be split differently from the recording
+	_, err = conn.Write([]byte("GE"))
+	require.NoError(t, err)
+	select {
+	case <-read:
+		t.Fatal("read returned before the request was complete")
+	case <-time.After(10 * time.Millisecond):
+	}
+	_, err = conn.Write([]byte("T a\n"))
+	require.NoError(t, err)
+	require.Equal(t, "value of ", <-read)
+	require.False(t, conn.Done())
+}
+
+func TestConnReplayWrites(t *testing.T) {
+	path := recordConversation(t)
+
+	conn, err := readchunkdump.NewConnReplayer(path)
+	require.NoError(t, err)
+	_, err = client(conn, "x")
+	require.ErrorIs(t, err, readchunkdump.ErrWriteMismatch)
+	require.ErrorContains(t, err, `byte 4 is 'x', expected 'a'`)
+
+	conn, err = readchunkdump.NewConnReplayer(path)
+	require.NoError(t, err)
+	_, err = client(conn, "a", "b", "c")
+	require.ErrorIs(t, err, readchunkdump.ErrWriteMismatch)
+
+	// with write recording, anything goes as long as the sizes line up
+	conn, err = readchunkdump.NewConnReplayer(path, readchunkdump.WithWriteRecording())
+	require.NoError(t, err)
+	out, err := client(conn, "x", "y")
+	require.NoError(t, err)
+	require.Equal(t, []string{"value of a\n", "value of b\n"}, out)
+	require.Equal(t, "GET x\nGET y\n", string(conn.Written()))
+}
+
+func TestConnReplayClose(t *testing.T) {
+	conn, err := readchunkdump.NewConnReplayer(recordConversation(t))
+	require.NoError(t, err)
+
+	done := make(chan error)
+	go func() {
+		_, err := conn.Read(make([]byte, 64))
+		done <- err
+	}()
+	require.NoError(t, conn.Close())
+	require.ErrorIs(t, <-done, net.ErrClosed)
+
+	// neither the rest of a chunk nor a chunk that is due are returned
+	conn, err = readchunkdump.NewConnReplayer(recordConversation(t))
+	require.NoError(t, err)
+	_, err = conn.Write([]byte("GET a\n"))
+	require.NoError(t, err)
+	_, err = conn.Read(make([]byte, 1))
+	require.NoError(t, err)
+	require.NoError(t, conn.Close())
+	_, err = conn.Read(make([]byte, 64))
+	require.ErrorIs(t, err, net.ErrClosed)
+	_, err = conn.Write([]byte("GET b\n"))
+	require.ErrorIs(t, err, net.ErrClosed)
+}
+
+func TestReplayKind(t *testing.T) {
+	conversation := recordConversation(t)
+	reads := recordingFile(t, []string{"data"}, []time.Duration{0})
+	dir := t.TempDir()
+	drain(t, readchunkdump.New(&chunkReader{chunks: chunks}, dir))
+	writes := filepath.Join(t.TempDir(), "writes")
+	wr, err := readchunkdump.CreateWriteRecorder(io.Discard, writes)
+	require.NoError(t, err)
+	_, err = wr.Write([]byte("data"))
+	require.NoError(t, err)
+	require.NoError(t, wr.Close())
+
+	requireKindError := func(err error, kind readchunkdump.Kind) {
+		t.Helper()
+		var kerr *readchunkdump.KindError
+		require.ErrorAs(t, err, &kerr)
+		require.Equal(t, kind, kerr.Kind)
+	}
+
+	_, err = readchunkdump.NewConnReplayer(reads)
+	requireKindError(err, readchunkdump.KIND_READS)
+	_, err = readchunkdump.NewConnReplayer(dir)
+	requireKindError(err, readchunkdump.KIND_READS)
+	_, err = readchunkdump.NewConnReplayer(writes)
+	requireKindError(err, readchunkdump.KIND_WRITES)
+
+	_, err = readchunkdump.NewReplayer(writes)
+	requireKindError(err, readchunkdump.KIND_WRITES)
+	require.ErrorContains(t, err, "recording of writes, expected reads or conversation")
+	_, err = readchunkdump.ReplayWrites(reads, io.Discard)
+	requireKindError(err, readchunkdump.KIND_READS)
+	_, err = readchunkdump.ReplayWrites(conversation, io.Discard)
+	requireKindError(err, readchunkdump.KIND_CONVERSATION)
+}
+
+func TestConnRecorderOrder(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err == nil {
+			serve(conn)
+		}
+	}()
+
+	clientConn, err := net.Dial("tcp", ln.Addr().String())
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "conversation")
+	rec, err := readchunkdump.CreateConnRecorder(clientConn, path)
+	require.NoError(t, err)
+
+	// one goroutine writes the requests while another reads the responses
+	const count = 500
+	var expected strings.Builder
+	go func() {
+		for i := range count {
+			fmt.Fprintf(rec, "GET %d\n", i)
+		}
+	}()
+	for i := range count {
+		fmt.Fprintf(&expected, "value of %d\n", i)
+	}
+	data := make([]byte, expected.Len())
+	_, err = io.ReadFull(rec, data)
+	require.NoError(t, err)
+	require.Equal(t, expected.String(), string(data))
+	require.NoError(t, rec.Close())
+
+	// a response is never recorded before the request that triggered it: it
+	// is due once the request is written, and not before
+	conn, err := readchunkdump.NewConnReplayer(path)
+	require.NoError(t, err)
+	defer conn.Close()
+	require.NoError(t, conn.SetReadDeadline(time.Now()))
+	var out []byte
+	buf := make([]byte, 4096)
+	for i := range count {
+		_, err := fmt.Fprintf(conn, "GET %d\n", i)
+		require.NoError(t, err)
+		for {
+			n, err := conn.Read(buf)
+			out = append(out, buf[:n]...)
+			if errors.Is(err, os.ErrDeadlineExceeded) || err == io.EOF {
+				break
+			}
+			require.NoError(t, err)
+		}
+		require.False(t, strings.Contains(string(out), fmt.Sprintf("value of %d\n", i+1)), "response %d served before its request", i+1)
+	}
+	require.Equal(t, expected.String(), string(out))
+}
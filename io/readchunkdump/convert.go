@@ -0,0 +1,60 @@
+package readchunkdump
+
+import (
+	"io"
+	"os"
+)
+
+// ConvertDir writes the chunk-N files of chunksdir as a recording file at dst.
+func ConvertDir(chunksdir string, dst string) error {
+	src, err := newDirSource(osPath(chunksdir))
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+
+	err = writeChunks(f, src)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(dst)
+	}
+	return err
+}
+
+func writeChunks(f *os.File, src chunkSource) error {
+	manifest := Manifest{Settings: map[string]string{"recorder": "readchunkdump.ConvertDir"}}
+	if m := src.manifest(); m != nil {
+		manifest.Source = m.Source
+		for k, v := range m.Settings {
+			manifest.Settings["original_"+k] = v
+		}
+	}
+
+	rw, err := newRecordWriter(f, KIND_READS, manifest)
+	if err != nil {
+		return err
+	}
+	for {
+		c, err := src.next()
+		if err != nil {
+			if err != io.EOF {
+				return err
+			}
+			return rw.finish()
+		}
+		if c.err != nil {
+			if err := rw.writeErr(c.err); err != nil {
+				return err
+			}
+		}
+		if err := rw.writeChunk(c.data); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package readchunkdump
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ReplayedError is a recorded error other than io.EOF and
+// io.ErrUnexpectedEOF. A recorded timeout is still a timeout: it has a
+// Timeout method returning true and matches os.ErrDeadlineExceeded.
+type ReplayedError struct {
+	Msg     string
+	timeout bool
+}
+
+func (e *ReplayedError) Error() string {
+	return e.Msg
+}
+
+func (e *ReplayedError) Timeout() bool {
+	return e.timeout
+}
+
+func (e *ReplayedError) Is(target error) bool {
+	return e.timeout && target == os.ErrDeadlineExceeded
+}
+
+// KindError is returned when opening a recording of the wrong kind, such as a
+// recording of writes with NewReplayer.
+type KindError struct {
+	Kind     Kind
+	Expected []Kind
+}
+
+func (e *KindError) Error() string {
+	expected := make([]string, len(e.Expected))
+	for i, k := range e.Expected {
+		expected[i] = k.String()
+	}
+	return fmt.Sprintf("recording of %s, expected %s", e.Kind, strings.Join(expected, " or "))
+}
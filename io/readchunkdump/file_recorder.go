@@ -0,0 +1,93 @@
+package readchunkdump
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// FileRecorder is T writing a single recording file: each Read of r appends
+// a chunk record, with the time the Read returned, its error and the size of
+// its buffer. Close writes the index; a recording that wasn't closed can still
+// be replayed. The first recording error stops the recording, the reads go on
+// unrecorded and Close returns it.
+type FileRecorder struct {
+	r io.Reader
+	recordingFile
+}
+
+func NewFileRecorder(r io.Reader, w io.Writer, opts ...RecordOption) (*FileRecorder, error) {
+	fr := &FileRecorder{r: r}
+	return fr, fr.init(w, KIND_READS, fr.manifest(opts))
+}
+
+// CreateFileRecorder records into a new file at path.
+func CreateFileRecorder(r io.Reader, path string, opts ...RecordOption) (*FileRecorder, error) {
+	fr := &FileRecorder{r: r}
+	return fr, fr.create(path, KIND_READS, fr.manifest(opts))
+}
+
+func (fr *FileRecorder) manifest(opts []RecordOption) Manifest {
+	return newManifest(opts, map[string]string{"recorder": "readchunkdump.FileRecorder"})
+}
+
+func (fr *FileRecorder) Read(in []byte) (n int, err error) {
+	n, err = fr.r.Read(in)
+	fr.record(in[:n], err, len(in))
+	return
+}
+
+// recordingFile writes the calls of a recorder to a recording file.
+type recordingFile struct {
+	rw     *recordWriter
+	closer io.Closer
+	start  time.Time
+	// err is the first recording error, nothing is written after it
+	err error
+}
+
+func (rf *recordingFile) init(w io.Writer, kind Kind, manifest Manifest) (err error) {
+	rf.rw, err = newRecordWriter(w, kind, manifest)
+	rf.start = time.Now()
+	return err
+}
+
+func (rf *recordingFile) create(path string, kind Kind, manifest Manifest) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := rf.init(f, kind, manifest); err != nil {
+		f.Close()
+		return err
+	}
+	rf.closer = f
+	return nil
+}
+
+// record writes a call. bufSize is the size of the buffer passed to Read, or
+// -1 for writes.
+func (rf *recordingFile) record(data []byte, err error, bufSize int) {
+	if rf.err == nil {
+		rf.err = rf.rw.writeCall(time.Since(rf.start), data, err, bufSize)
+	}
+}
+
+// Close writes the manifest and the index, and closes the file the recorder
+// created. It doesn't close the reader or writer being recorded.
+func (rf *recordingFile) Close() error {
+	if rf.err != nil {
+		if rf.closer != nil {
+			rf.closer.Close()
+		}
+		return fmt.Errorf("recording stopped: %w", rf.err)
+	}
+	err := rf.rw.finish()
+	if rf.closer != nil {
+		if cerr := rf.closer.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
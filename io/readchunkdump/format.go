@@ -0,0 +1,315 @@
+package readchunkdump
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"time"
+)
+
+// A recording in a single file starts with a header:
+//
+//	magic "RCHUNKS\x00" | version byte | kind byte
+//
+// followed by records:
+//
+//	tag byte | uvarint payload length | payload
+//
+// Every recorded call is a tagChunk record holding its bytes, preceded by the
+// records describing the call:
+//
+//	tagTime: uvarint nanoseconds between the start of the recording and the
+//	return of the call
+//	tagErr: the error returned by the call, a kind byte (errKind) and the
+//	error message
+//	tagBufSize: uvarint size of the buffer passed to Read
+//	tagDropped: uvarint number of calls before this one that weren't recorded
+//	tagDirection: in conversations, directionWrite for the calls to Write
+//
+// Records with an unknown tag are skipped. A recording that was closed ends
+// with a tagManifest record holding the JSON Manifest, a tagIndex record with
+// the uvarint count and offsets of the chunk records, and a footer: the offset
+// of the index record as a little-endian uint64 and the magic.
+const (
+	magic          = "RCHUNKS\x00"
+	formatVersion  = 1
+	headerSize     = len(magic) + 2
+	footerSize     = 8 + len(magic)
+	maxPayloadSize = 1 << 30
+)
+
+const (
+	tagChunk     byte = 1
+	tagIndex     byte = 2
+	tagTime      byte = 3
+	tagErr       byte = 4
+	tagBufSize   byte = 5
+	tagManifest  byte = 6
+	tagDropped   byte = 7
+	tagDirection byte = 8
+)
+
+const (
+	directionRead byte = iota
+	directionWrite
+)
+
+const (
+	errKindEOF byte = iota + 1
+	errKindUnexpectedEOF
+	errKindTimeout
+	errKindOther
+)
+
+// Kind is the kind of calls a recording holds.
+type Kind byte
+
+const (
+	// KIND_READS recordings hold the chunks returned by Read calls
+	KIND_READS Kind = iota
+	// KIND_WRITES recordings hold the bytes passed to Write calls
+	KIND_WRITES
+	// KIND_CONVERSATION recordings hold both the Read and the Write calls of
+	// a connection, in the order they returned
+	KIND_CONVERSATION
+)
+
+func (k Kind) String() string {
+	switch k {
+	case KIND_READS:
+		return "reads"
+	case KIND_WRITES:
+		return "writes"
+	case KIND_CONVERSATION:
+		return "conversation"
+	}
+	return fmt.Sprintf("unknown kind %d", byte(k))
+}
+
+var (
+	ErrFormat  = errors.New("malformed chunk recording")
+	ErrDropped = errors.New("calls were dropped while recording")
+)
+
+type recordWriter struct {
+	w        io.Writer
+	off      int64
+	chunks   []int64
+	manifest Manifest
+	scratch  []byte
+}
+
+func newRecordWriter(w io.Writer, kind Kind, manifest Manifest) (*recordWriter, error) {
+	rw := &recordWriter{w: w, manifest: manifest}
+	header := append([]byte(magic), formatVersion, byte(kind))
+	return rw, rw.write(header)
+}
+
+func (rw *recordWriter) write(b []byte) error {
+	n, err := rw.w.Write(b)
+	rw.off += int64(n)
+	return err
+}
+
+func (rw *recordWriter) writeRecord(tag byte, payload []byte) error {
+	rw.scratch = append(rw.scratch[:0], tag)
+	rw.scratch = binary.AppendUvarint(rw.scratch, uint64(len(payload)))
+	if err := rw.write(rw.scratch); err != nil {
+		return err
+	}
+	return rw.write(payload)
+}
+
+// writeCall writes the records of a call. bufSize is the size of the buffer
+// passed to Read, or -1 for writes.
+func (rw *recordWriter) writeCall(at time.Duration, data []byte, err error, bufSize int) error {
+	if werr := rw.writeTime(at); werr != nil {
+		return werr
+	}
+	if bufSize >= 0 {
+		if werr := rw.writeBufSize(bufSize); werr != nil {
+			return werr
+		}
+	}
+	if err != nil {
+		if werr := rw.writeErr(err); werr != nil {
+			return werr
+		}
+	}
+	return rw.writeChunk(data)
+}
+
+func (rw *recordWriter) writeDropped(count int) error {
+	return rw.writeRecord(tagDropped, binary.AppendUvarint(nil, uint64(count)))
+}
+
+func (rw *recordWriter) writeTime(at time.Duration) error {
+	return rw.writeRecord(tagTime, binary.AppendUvarint(nil, uint64(at)))
+}
+
+func (rw *recordWriter) writeBufSize(size int) error {
+	return rw.writeRecord(tagBufSize, binary.AppendUvarint(nil, uint64(size)))
+}
+
+func (rw *recordWriter) writeErr(err error) error {
+	return rw.writeRecord(tagErr, encodeErr(err))
+}
+
+// encodeErr encodes err as an error kind byte and the error message.
+func encodeErr(err error) []byte {
+	var kind byte
+	switch {
+	case err == io.EOF:
+		kind = errKindEOF
+	case err == io.ErrUnexpectedEOF:
+		kind = errKindUnexpectedEOF
+	case isTimeout(err):
+		kind = errKindTimeout
+	default:
+		kind = errKindOther
+	}
+	return append([]byte{kind}, err.Error()...)
+}
+
+func isTimeout(err error) bool {
+	var timeout interface{ Timeout() bool }
+	if errors.As(err, &timeout) && timeout.Timeout() {
+		return true
+	}
+	return errors.Is(err, os.ErrDeadlineExceeded)
+}
+
+func decodeErr(payload []byte) (error, error) {
+	if len(payload) == 0 {
+		return nil, fmt.Errorf("%w: empty error record", ErrFormat)
+	}
+	msg := string(payload[1:])
+	switch payload[0] {
+	case errKindEOF:
+		return io.EOF, nil
+	case errKindUnexpectedEOF:
+		return io.ErrUnexpectedEOF, nil
+	case errKindTimeout:
+		return &ReplayedError{Msg: msg, timeout: true}, nil
+	default:
+		return &ReplayedError{Msg: msg}, nil
+	}
+}
+
+func (rw *recordWriter) writeChunk(data []byte) error {
+	rw.chunks = append(rw.chunks, rw.off)
+	rw.manifest.add(data)
+	return rw.writeRecord(tagChunk, data)
+}
+
+// finish writes the manifest, the index and the footer.
+func (rw *recordWriter) finish() error {
+	manifest, err := json.Marshal(rw.manifest)
+	if err != nil {
+		return err
+	}
+	if err := rw.writeRecord(tagManifest, manifest); err != nil {
+		return err
+	}
+
+	index := binary.AppendUvarint(nil, uint64(len(rw.chunks)))
+	for _, off := range rw.chunks {
+		index = binary.AppendUvarint(index, uint64(off))
+	}
+
+	indexOff := rw.off
+	if err := rw.writeRecord(tagIndex, index); err != nil {
+		return err
+	}
+
+	footer := binary.LittleEndian.AppendUint64(nil, uint64(indexOff))
+	return rw.write(append(footer, magic...))
+}
+
+type recordReader struct {
+	r    *bufio.Reader
+	kind Kind
+	// offset of the next record
+	off int64
+}
+
+func newRecordReader(r io.Reader) (*recordReader, error) {
+	rr := &recordReader{r: bufio.NewReader(r)}
+
+	header := make([]byte, headerSize)
+	if _, err := io.ReadFull(rr.r, header); err != nil {
+		return nil, fmt.Errorf("%w: reading header: %w", ErrFormat, err)
+	}
+	if string(header[:len(magic)]) != magic {
+		return nil, fmt.Errorf("%w: bad magic", ErrFormat)
+	}
+	if v := header[len(magic)]; v != formatVersion {
+		return nil, fmt.Errorf("%w: unsupported version %d", ErrFormat, v)
+	}
+	rr.kind = Kind(header[len(magic)+1])
+	rr.off = int64(headerSize)
+	return rr, nil
+}
+
+// next returns the next record. It returns io.EOF at the index, or at the end
+// of a recording that wasn't closed, including in a record cut short by it.
+func (rr *recordReader) next() (tag byte, payload []byte, err error) {
+	tag, payload, size, err := readRecord(rr.r, rr.off)
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		return 0, nil, io.EOF
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+	rr.off += size
+	if tag == tagIndex {
+		return 0, nil, io.EOF
+	}
+	return tag, payload, nil
+}
+
+// readRecord reads the record at offset off of r, and returns its size.
+func readRecord(r *bufio.Reader, off int64) (tag byte, payload []byte, size int64, err error) {
+	tag, err = r.ReadByte()
+	if err != nil {
+		return 0, nil, 0, err
+	}
+	length, err := binary.ReadUvarint(r)
+	if err != nil {
+		return 0, nil, 0, fmt.Errorf("%w: record at %d: %w", ErrFormat, off, noEOF(err))
+	}
+	if length > maxPayloadSize {
+		return 0, nil, 0, fmt.Errorf("%w: record at %d: payload of %d bytes", ErrFormat, off, length)
+	}
+
+	payload = make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, nil, 0, fmt.Errorf("%w: record at %d: %w", ErrFormat, off, noEOF(err))
+	}
+	return tag, payload, 1 + int64(uvarintLen(length)) + int64(length), nil
+}
+
+func noEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+func uvarintLen(x uint64) int {
+	var buf [binary.MaxVarintLen64]byte
+	return binary.PutUvarint(buf[:], x)
+}
+
+func isRecordingFile(fsys fs.FS, name string) (bool, error) {
+	info, err := fs.Stat(fsys, name)
+	if err != nil {
+		return false, err
+	}
+	return !info.IsDir(), nil
+}
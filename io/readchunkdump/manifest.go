@@ -0,0 +1,136 @@
+package readchunkdump
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+)
+
+// manifestName is the manifest of a chunk directory.
+const manifestName = "manifest.json"
+
+var ErrManifest = errors.New("recording doesn't match its manifest")
+
+// Manifest describes a recording. Recorders write it when they are closed,
+// as manifest.json in a chunk directory or as a record of a recording file,
+// and NewReplayer checks the recording against it. The manifest is optional:
+// recordings without one, such as those of a recorder that wasn't closed, are
+// replayed without any check.
+type Manifest struct {
+	// Source describes what was recorded, see WithSource
+	Source string `json:"source,omitempty"`
+	// Settings are the settings of the recorder, see WithSetting
+	Settings   map[string]string `json:"settings,omitempty"`
+	ChunkCount int               `json:"chunk_count"`
+	Chunks     []ChunkInfo       `json:"chunks"`
+
+	// Dropped is the number of calls an AsyncRecorder didn't record
+	Dropped int `json:"dropped,omitempty"`
+	// Capped is set when an AsyncRecorder stopped at one of its caps
+	Capped bool `json:"capped,omitempty"`
+}
+
+type ChunkInfo struct {
+	Size   int    `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+func chunkInfo(data []byte) ChunkInfo {
+	sum := sha256.Sum256(data)
+	return ChunkInfo{Size: len(data), SHA256: hex.EncodeToString(sum[:])}
+}
+
+func (m *Manifest) add(data []byte) {
+	m.Chunks = append(m.Chunks, chunkInfo(data))
+	m.ChunkCount++
+}
+
+func (m *Manifest) validate() error {
+	if m.ChunkCount != len(m.Chunks) {
+		return fmt.Errorf("%w: chunk_count is %d, but %d chunks are listed", ErrManifest, m.ChunkCount, len(m.Chunks))
+	}
+	return nil
+}
+
+// check compares the chunks of a recording to the manifest.
+func (m *Manifest) check(chunks []ChunkInfo) error {
+	if len(chunks) != m.ChunkCount {
+		return fmt.Errorf("%w: %d chunks, expected %d", ErrManifest, len(chunks), m.ChunkCount)
+	}
+	for i, got := range chunks {
+		if err := m.checkChunk(i, got); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *Manifest) checkChunk(i int, got ChunkInfo) error {
+	expected := m.Chunks[i]
+	if expected.Size != got.Size {
+		return fmt.Errorf("%w: chunk %d has %d bytes, expected %d", ErrManifest, i, got.Size, expected.Size)
+	}
+	if expected.SHA256 != got.SHA256 {
+		return fmt.Errorf("%w: chunk %d has sha256 %s, expected %s", ErrManifest, i, got.SHA256, expected.SHA256)
+	}
+	return nil
+}
+
+func readManifest(fsys fs.FS, chunksdir string) (*Manifest, error) {
+	data, err := fs.ReadFile(fsys, path.Join(chunksdir, manifestName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return decodeManifest(data)
+}
+
+func decodeManifest(data []byte) (*Manifest, error) {
+	m := &Manifest{}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrManifest, err)
+	}
+	return m, m.validate()
+}
+
+type RecordOption func(*recordOptions)
+
+type recordOptions struct {
+	source   string
+	settings map[string]string
+}
+
+// WithSource describes what is being recorded in the manifest, such as a
+// command line or an address.
+func WithSource(source string) RecordOption {
+	return func(o *recordOptions) {
+		o.source = source
+	}
+}
+
+// WithSetting adds a setting to the manifest, on top of the ones of the
+// recorder.
+func WithSetting(key, value string) RecordOption {
+	return func(o *recordOptions) {
+		if o.settings == nil {
+			o.settings = map[string]string{}
+		}
+		o.settings[key] = value
+	}
+}
+
+// newManifest returns the manifest of a recording made with opts. settings
+// are the settings of the recorder.
+func newManifest(opts []RecordOption, settings map[string]string) Manifest {
+	o := recordOptions{settings: settings}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return Manifest{Source: o.source, Settings: o.settings, Chunks: []ChunkInfo{}}
+}
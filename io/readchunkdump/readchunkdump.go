@@ -1,22 +1,29 @@
 package readchunkdump
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
 	"path"
 )
 
+// T records the chunks returned by each Read of r as chunk-N files in
+// chunksdir, and the error of the Read, if any, as chunk-N.err next to it.
+// FileRecorder also records the time of each Read and the size of its buffer.
+// Close writes the manifest.
 type T struct {
 	r         io.Reader
 	chunksdir string
 	cnt       int
+	manifest  Manifest
 }
 
-func New(r io.Reader, chunksdir string) *T {
+func New(r io.Reader, chunksdir string, opts ...RecordOption) *T {
 	t := &T{
 		r:         r,
 		chunksdir: chunksdir,
+		manifest:  newManifest(opts, map[string]string{"recorder": "readchunkdump.T"}),
 	}
 
 	return t
@@ -31,11 +38,29 @@ func (t *T) Read(in []byte) (n int, err error) {
 		0o666,
 	)
 
+	if werr == nil && err != nil {
+		werr = os.WriteFile(
+			path.Join(t.chunksdir, fmt.Sprintf("chunk-%d%s", t.cnt, errSuffix)),
+			encodeErr(err),
+			0o666,
+		)
+	}
+
 	if werr != nil {
 		panic(werr)
 	}
 
+	t.manifest.add(in[:n])
 	t.cnt++
 
 	return
 }
+
+// Close writes manifest.json. It doesn't close r.
+func (t *T) Close() error {
+	data, err := json.MarshalIndent(t.manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path.Join(t.chunksdir, manifestName), data, 0o666)
+}
@@ -0,0 +1,774 @@
+package readchunkdump_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"testing/iotest"
+	"time"
+
+	"github.com/asymmetric-research/go-commons/io/readchunkdump"
+	"github.com/stretchr/testify/require"
+)
+
+// chunkReader returns one chunk per Read call.
+type chunkReader struct {
+	chunks []string
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	if len(r.chunks) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(p, r.chunks[0])
+	r.chunks = r.chunks[1:]
+	return n, nil
+}
+
+var chunks = []string{"first line\nsec", "ond line\n", "", "third"}
+
+func replay(t *testing.T, recording string) []string {
+	r, err := readchunkdump.NewReplayer(recording)
+	require.NoError(t, err)
+	defer r.Close()
+
+	var out []string
+	buf := make([]byte, 64)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 || err == nil {
+			out = append(out, string(buf[:n]))
+		}
+		if err == io.EOF {
+			return out
+		}
+		require.NoError(t, err)
+	}
+}
+
+func drain(t *testing.T, r io.Reader) {
+	buf := make([]byte, 64)
+	for {
+		_, err := r.Read(buf)
+		if err == io.EOF {
+			return
+		}
+		require.NoError(t, err)
+	}
+}
+
+func TestFileRecorder(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "recording")
+	fr, err := readchunkdump.CreateFileRecorder(&chunkReader{chunks: chunks}, path)
+	require.NoError(t, err)
+	drain(t, fr)
+	require.NoError(t, fr.Close())
+
+	require.Equal(t, chunks, replay(t, path))
+
+	// the final read, returning EOF, is recorded as an empty chunk
+	expected := append(append([]string{}, chunks...), "")
+
+	rec, err := readchunkdump.OpenRecording(path)
+	require.NoError(t, err)
+	defer rec.Close()
+	require.Equal(t, readchunkdump.KIND_READS, rec.Kind())
+	require.Equal(t, len(expected), rec.Len())
+	for i := rec.Len() - 1; i >= 0; i-- {
+		chunk, err := rec.Chunk(i)
+		require.NoError(t, err)
+		require.Equal(t, expected[i], string(chunk))
+	}
+}
+
+func TestFileRecorderNotClosed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "recording")
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	defer f.Close()
+
+	fr, err := readchunkdump.NewFileRecorder(&chunkReader{chunks: chunks}, f)
+	require.NoError(t, err)
+	drain(t, fr)
+
+	// without the index, chunks are found by scanning
+	require.Equal(t, chunks, replay(t, path))
+	rec, err := readchunkdump.OpenRecording(path)
+	require.NoError(t, err)
+	defer rec.Close()
+	require.Equal(t, len(chunks)+1, rec.Len())
+	_, err = rec.Chunk(rec.Len())
+	require.Error(t, err)
+	_, err = rec.Chunk(-1)
+	require.Error(t, err)
+
+	// a record cut short by a crash ends the recording
+	_, err = f.Write([]byte("\x01\x05ab"))
+	require.NoError(t, err)
+	require.Equal(t, chunks, replay(t, path))
+	truncated, err := readchunkdump.OpenRecording(path)
+	require.NoError(t, err)
+	defer truncated.Close()
+	require.Equal(t, len(chunks)+1, truncated.Len())
+}
+
+func TestConvertDir(t *testing.T) {
+	dir := t.TempDir()
+	drain(t, readchunkdump.New(&chunkReader{chunks: chunks}, dir))
+
+	path := filepath.Join(t.TempDir(), "recording")
+	require.NoError(t, readchunkdump.ConvertDir(dir, path))
+	require.Equal(t, chunks, replay(t, dir))
+	require.Equal(t, chunks, replay(t, path))
+}
+
+func TestDirRecordsErrors(t *testing.T) {
+	errBroken := errors.New("broken")
+	dir := t.TempDir()
+	rec := readchunkdump.New(io.MultiReader(strings.NewReader("data"), iotest.ErrReader(errBroken)), dir)
+	out, err := io.ReadAll(rec)
+	require.ErrorIs(t, err, errBroken)
+	require.Equal(t, "data", string(out))
+	require.NoError(t, rec.Close())
+
+	path := filepath.Join(t.TempDir(), "recording")
+	require.NoError(t, readchunkdump.ConvertDir(dir, path))
+
+	// the replay ends like the reads did, converted or not
+	for _, recording := range []string{dir, path} {
+		r, err := readchunkdump.NewReplayer(recording)
+		require.NoError(t, err)
+		out, err = io.ReadAll(r)
+		require.EqualError(t, err, "broken")
+		require.Equal(t, "data", string(out))
+		require.NoError(t, r.Close())
+	}
+}
+
+func TestReplayerTrailingSlash(t *testing.T) {
+	dir := t.TempDir()
+	drain(t, readchunkdump.New(&chunkReader{chunks: chunks}, dir))
+	require.Equal(t, replay(t, dir), replay(t, dir+string(filepath.Separator)))
+
+	// the root is a directory like any other, and not a recording
+	_, err := readchunkdump.NewReplayer(string(filepath.Separator))
+	require.ErrorIs(t, err, readchunkdump.ErrFormat)
+}
+
+func TestUnknownRecordsSkipped(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "recording")
+	data := "RCHUNKS\x00\x01\x00" +
+		"\x01\x02ab" + // chunk
+		"\x7f\x03xyz" + // unknown record
+		"\x01\x01c"
+	require.NoError(t, os.WriteFile(path, []byte(data), 0o644))
+	require.Equal(t, []string{"ab", "c"}, replay(t, path))
+}
+
+func TestMalformed(t *testing.T) {
+	for name, data := range map[string]string{
+		"bad magic":    "NOTCHUNKS\x01\x00",
+		"short header": "RCHUNKS",
+		"bad version":  "RCHUNKS\x00\x09\x00",
+		"bad record":   "RCHUNKS\x00\x01\x00\x01\xff\xff\xff\xff\xff\xff\xff\xff\xff\x01",
+	} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "recording")
+			require.NoError(t, os.WriteFile(path, []byte(data), 0o644))
+
+			r, err := readchunkdump.NewReplayer(path)
+			if err == nil {
+				defer r.Close()
+				_, err = io.ReadAll(r)
+			}
+			require.True(t, errors.Is(err, readchunkdump.ErrFormat), "%v", err)
+		})
+	}
+}
+
+// recordingFile writes a recording of chunks returned at the given times.
+func recordingFile(t *testing.T, chunks []string, times []time.Duration) string {
+	data := []byte("RCHUNKS\x00\x01\x00")
+	for i, chunk := range chunks {
+		at := binary.AppendUvarint(nil, uint64(times[i]))
+		data = append(data, 3, byte(len(at)))
+		data = append(data, at...)
+		data = append(data, 1, byte(len(chunk)))
+		data = append(data, chunk...)
+	}
+	path := filepath.Join(t.TempDir(), "recording")
+	require.NoError(t, os.WriteFile(path, data, 0o644))
+	return path
+}
+
+func TestTimedReplay(t *testing.T) {
+	path := recordingFile(t, []string{"a", "b", "c"}, []time.Duration{
+		10 * time.Millisecond, 30 * time.Millisecond, 30 * time.Millisecond,
+	})
+	buf := make([]byte, 8)
+
+	for _, tc := range []struct {
+		opts     []readchunkdump.ReplayOption
+		expected []time.Duration
+	}{
+		{nil, []time.Duration{0, 0, 0}},
+		{[]readchunkdump.ReplayOption{readchunkdump.WithTiming(1)}, []time.Duration{10, 30, 30}},
+		{[]readchunkdump.ReplayOption{readchunkdump.WithTiming(0.5)}, []time.Duration{5, 15, 15}},
+	} {
+		clock := &readchunkdump.VirtualClock{}
+		r, err := readchunkdump.NewReplayer(path, append(tc.opts, readchunkdump.WithClock(clock))...)
+		require.NoError(t, err)
+
+		for _, expected := range tc.expected {
+			_, err := r.Read(buf)
+			require.NoError(t, err)
+			require.Equal(t, expected*time.Millisecond, clock.Now())
+		}
+		require.NoError(t, r.Close())
+	}
+
+	// time spent by the consumer counts towards the delay
+	clock := &readchunkdump.VirtualClock{}
+	r, err := readchunkdump.NewReplayer(path, readchunkdump.WithTiming(1), readchunkdump.WithClock(clock))
+	require.NoError(t, err)
+	defer r.Close()
+	clock.Advance(25 * time.Millisecond)
+	_, err = r.Read(buf)
+	require.NoError(t, err)
+	require.Equal(t, 25*time.Millisecond, clock.Now())
+	_, err = r.Read(buf)
+	require.NoError(t, err)
+	require.Equal(t, 30*time.Millisecond, clock.Now())
+}
+
+// sleepyReader sleeps before returning each chunk.
+type sleepyReader struct {
+	chunkReader
+	delay time.Duration
+}
+
+func (r *sleepyReader) Read(p []byte) (int, error) {
+	time.Sleep(r.delay)
+	return r.chunkReader.Read(p)
+}
+
+func TestRecordTiming(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "recording")
+	src := &sleepyReader{chunkReader{chunks: []string{"a", "b"}}, 10 * time.Millisecond}
+	fr, err := readchunkdump.CreateFileRecorder(src, path)
+	require.NoError(t, err)
+	drain(t, fr)
+	require.NoError(t, fr.Close())
+
+	clock := &readchunkdump.VirtualClock{}
+	r, err := readchunkdump.NewReplayer(path, readchunkdump.WithTiming(1), readchunkdump.WithClock(clock))
+	require.NoError(t, err)
+	defer r.Close()
+
+	buf := make([]byte, 8)
+	var prev time.Duration
+	for i := range 3 {
+		_, err := r.Read(buf)
+		if i == 2 {
+			// the final read returned EOF after a delay too
+			require.Equal(t, io.EOF, err)
+		} else {
+			require.NoError(t, err)
+		}
+		require.GreaterOrEqual(t, clock.Now()-prev, 10*time.Millisecond)
+		prev = clock.Now()
+	}
+}
+
+type result struct {
+	data string
+	err  error
+}
+
+// resultReader returns the given results, then io.EOF.
+type resultReader struct {
+	results []result
+}
+
+func (r *resultReader) Read(p []byte) (int, error) {
+	if len(r.results) == 0 {
+		return 0, io.EOF
+	}
+	res := r.results[0]
+	r.results = r.results[1:]
+	return copy(p, res.data), res.err
+}
+
+func TestRecordErrors(t *testing.T) {
+	errBroken := errors.New("connection reset")
+	results := []result{
+		{"", nil},
+		{"data", nil},
+		{"", os.ErrDeadlineExceeded},
+		{"partial", io.ErrUnexpectedEOF},
+		{"", errBroken},
+		{"last", io.EOF},
+	}
+
+	path := filepath.Join(t.TempDir(), "recording")
+	fr, err := readchunkdump.CreateFileRecorder(&resultReader{results: results}, path)
+	require.NoError(t, err)
+	buf := make([]byte, 16)
+	for range results {
+		fr.Read(buf)
+	}
+	require.NoError(t, fr.Close())
+
+	r, err := readchunkdump.NewReplayer(path)
+	require.NoError(t, err)
+	defer r.Close()
+
+	for _, expected := range results {
+		n, err := r.Read(buf)
+		require.Equal(t, expected.data, string(buf[:n]))
+
+		switch expected.err {
+		case nil, io.EOF, io.ErrUnexpectedEOF:
+			require.Equal(t, expected.err, err)
+		case os.ErrDeadlineExceeded:
+			require.ErrorIs(t, err, os.ErrDeadlineExceeded)
+			var timeout interface{ Timeout() bool }
+			require.ErrorAs(t, err, &timeout)
+			require.True(t, timeout.Timeout())
+		default:
+			require.EqualError(t, err, expected.err.Error())
+			require.NotErrorIs(t, err, os.ErrDeadlineExceeded)
+		}
+	}
+
+	// past the recording
+	_, err = r.Read(buf)
+	require.Equal(t, io.EOF, err)
+}
+
+// callWriter keeps the bytes of each Write call.
+type callWriter struct {
+	calls []string
+	err   error
+}
+
+func (w *callWriter) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	w.calls = append(w.calls, string(p))
+	return len(p), nil
+}
+
+func TestWriteRecorder(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "recording")
+	var out bytes.Buffer
+	wr, err := readchunkdump.CreateWriteRecorder(&out, path)
+	require.NoError(t, err)
+	for _, chunk := range chunks {
+		n, err := wr.Write([]byte(chunk))
+		require.NoError(t, err)
+		require.Equal(t, len(chunk), n)
+	}
+	require.NoError(t, wr.Close())
+	require.Equal(t, strings.Join(chunks, ""), out.String())
+
+	rec, err := readchunkdump.OpenRecording(path)
+	require.NoError(t, err)
+	require.Equal(t, readchunkdump.KIND_WRITES, rec.Kind())
+	require.NoError(t, rec.Close())
+
+	w := &callWriter{}
+	written, err := readchunkdump.ReplayWrites(path, w)
+	require.NoError(t, err)
+	require.Equal(t, int64(out.Len()), written)
+	require.Equal(t, chunks, w.calls)
+
+	errFull := errors.New("disk full")
+	_, err = readchunkdump.ReplayWrites(path, &callWriter{err: errFull})
+	require.Equal(t, errFull, err)
+}
+
+// shortWriter takes at most n bytes of each Write call.
+type shortWriter struct {
+	n int
+}
+
+func (w shortWriter) Write(p []byte) (int, error) {
+	if len(p) > w.n {
+		return w.n, io.ErrShortWrite
+	}
+	return len(p), nil
+}
+
+func TestWriteRecorderShortWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "recording")
+	wr, err := readchunkdump.CreateWriteRecorder(shortWriter{n: 3}, path)
+	require.NoError(t, err)
+	n, err := wr.Write([]byte("data"))
+	require.Equal(t, io.ErrShortWrite, err)
+	require.Equal(t, 3, n)
+	require.NoError(t, wr.Close())
+
+	// only the bytes the writer took are replayed
+	w := &callWriter{}
+	_, err = readchunkdump.ReplayWrites(path, w)
+	require.NoError(t, err)
+	require.Equal(t, []string{"dat"}, w.calls)
+}
+
+func TestRecordingError(t *testing.T) {
+	errFull := errors.New("disk full")
+
+	// the reads go on, Close reports the recording error
+	out := &callWriter{}
+	fr, err := readchunkdump.NewFileRecorder(&chunkReader{chunks: chunks}, out)
+	require.NoError(t, err)
+	out.err = errFull
+	data, err := io.ReadAll(fr)
+	require.NoError(t, err)
+	require.Equal(t, strings.Join(chunks, ""), string(data))
+	require.ErrorIs(t, fr.Close(), errFull)
+
+	out = &callWriter{}
+	wr, err := readchunkdump.NewWriteRecorder(io.Discard, out)
+	require.NoError(t, err)
+	out.err = errFull
+	n, err := wr.Write([]byte("data"))
+	require.NoError(t, err)
+	require.Equal(t, 4, n)
+	require.ErrorIs(t, wr.Close(), errFull)
+}
+
+func TestReplaySmallBuffer(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "recording")
+	src := &resultReader{results: []result{{"hello world", nil}, {"", nil}, {"bye", io.EOF}}}
+	fr, err := readchunkdump.CreateFileRecorder(src, path)
+	require.NoError(t, err)
+	drain(t, fr)
+	require.NoError(t, fr.Close())
+
+	r, err := readchunkdump.NewReplayer(path)
+	require.NoError(t, err)
+	defer r.Close()
+
+	buf := make([]byte, 4)
+	var got []result
+	for {
+		n, err := r.Read(buf)
+		got = append(got, result{string(buf[:n]), err})
+		if err != nil {
+			break
+		}
+	}
+	require.Equal(t, []result{
+		{"hell", nil}, {"o wo", nil}, {"rld", nil},
+		{"", nil},
+		{"bye", io.EOF},
+	}, got)
+}
+
+// fakeTB collects the errors of a strict replay.
+type fakeTB struct {
+	errors []string
+}
+
+func (tb *fakeTB) Helper() {}
+
+func (tb *fakeTB) Errorf(format string, args ...any) {
+	tb.errors = append(tb.errors, fmt.Sprintf(format, args...))
+}
+
+func TestReplayStrict(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "recording")
+	fr, err := readchunkdump.CreateFileRecorder(&chunkReader{chunks: []string{"abcdef", "gh"}}, path)
+	require.NoError(t, err)
+	drain(t, fr) // reads with 64 byte buffers
+	require.NoError(t, fr.Close())
+
+	tb := &fakeTB{}
+	r, err := readchunkdump.NewReplayer(path, readchunkdump.WithStrict(tb))
+	require.NoError(t, err)
+	defer r.Close()
+
+	_, err = r.Read(make([]byte, 64))
+	require.NoError(t, err)
+	require.Empty(t, tb.errors)
+
+	// only the read starting the chunk is checked
+	buf := make([]byte, 1)
+	r.Read(buf)
+	r.Read(buf)
+	require.Equal(t, []string{"readchunkdump: read 2 has a buffer of 1 bytes, recorded with 64"}, tb.errors)
+
+	// chunk directories have no buffer sizes, chunks only have to fit
+	dir := t.TempDir()
+	drain(t, readchunkdump.New(&chunkReader{chunks: chunks}, dir))
+	r, err = readchunkdump.NewReplayer(dir, readchunkdump.WithStrict(t))
+	require.NoError(t, err)
+	_, err = io.ReadAll(r)
+	require.NoError(t, err)
+
+	tb = &fakeTB{}
+	r, err = readchunkdump.NewReplayer(dir, readchunkdump.WithStrict(tb))
+	require.NoError(t, err)
+	_, err = r.Read(make([]byte, 4))
+	require.NoError(t, err)
+	require.Equal(t, []string{"readchunkdump: read 1 has a buffer of 4 bytes, smaller than its chunk of 14"}, tb.errors)
+}
+
+func TestManifest(t *testing.T) {
+	dir := t.TempDir()
+	rec := readchunkdump.New(&chunkReader{chunks: chunks}, dir,
+		readchunkdump.WithSource("test chunks"),
+		readchunkdump.WithSetting("block_size", "64"),
+	)
+	drain(t, rec)
+	require.NoError(t, rec.Close())
+
+	path := filepath.Join(t.TempDir(), "recording")
+	require.NoError(t, readchunkdump.ConvertDir(dir, path))
+
+	for _, recording := range []string{dir, path} {
+		r, err := readchunkdump.NewReplayer(recording)
+		require.NoError(t, err)
+		m := r.Manifest()
+		require.NotNil(t, m)
+		require.Equal(t, "test chunks", m.Source)
+		require.Equal(t, len(chunks)+1, m.ChunkCount)
+		require.Equal(t, len("ond line\n"), m.Chunks[1].Size)
+		require.Len(t, m.Chunks[1].SHA256, 64)
+		require.NoError(t, r.Close())
+	}
+
+	r, err := readchunkdump.NewReplayer(path)
+	require.NoError(t, err)
+	defer r.Close()
+	require.Equal(t, map[string]string{
+		"recorder":            "readchunkdump.ConvertDir",
+		"original_recorder":   "readchunkdump.T",
+		"original_block_size": "64",
+	}, r.Manifest().Settings)
+}
+
+func TestManifestMismatch(t *testing.T) {
+	record := func(t *testing.T) string {
+		dir := t.TempDir()
+		rec := readchunkdump.New(&chunkReader{chunks: chunks}, dir)
+		drain(t, rec)
+		require.NoError(t, rec.Close())
+		return dir
+	}
+
+	for name, tc := range map[string]struct {
+		tamper   func(dir string) error
+		expected string
+	}{
+		"modified chunk": {
+			func(dir string) error {
+				return os.WriteFile(filepath.Join(dir, "chunk-1"), []byte("ond lime\n"), 0o644)
+			},
+			"chunk 1 has sha256",
+		},
+		"resized chunk": {
+			func(dir string) error { return os.WriteFile(filepath.Join(dir, "chunk-0"), []byte("x"), 0o644) },
+			"chunk 0 has 1 bytes, expected 14",
+		},
+		"missing chunk": {
+			func(dir string) error { return os.Remove(filepath.Join(dir, "chunk-2")) },
+			"chunk-2 is missing",
+		},
+		"missing last chunk": {
+			func(dir string) error {
+				return errors.Join(os.Remove(filepath.Join(dir, "chunk-4")), os.Remove(filepath.Join(dir, "chunk-4.err")))
+			},
+			"4 chunks, expected 5",
+		},
+		"error without chunk": {
+			func(dir string) error { return os.Remove(filepath.Join(dir, "chunk-4")) },
+			"chunk-4.err has no chunk",
+		},
+		"stray file": {
+			func(dir string) error { return os.WriteFile(filepath.Join(dir, ".DS_Store"), nil, 0o644) },
+			`stray file ".DS_Store"`,
+		},
+		"bad manifest": {
+			func(dir string) error {
+				return os.WriteFile(filepath.Join(dir, "manifest.json"), []byte(`{"chunk_count": 3, "chunks": []}`), 0o644)
+			},
+			"chunk_count is 3, but 0 chunks are listed",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			dir := record(t)
+			require.NoError(t, tc.tamper(dir))
+			_, err := readchunkdump.NewReplayer(dir)
+			require.ErrorContains(t, err, tc.expected)
+		})
+	}
+
+	t.Run("recording file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "recording")
+		fr, err := readchunkdump.CreateFileRecorder(&chunkReader{chunks: chunks}, path)
+		require.NoError(t, err)
+		drain(t, fr)
+		require.NoError(t, fr.Close())
+
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		data[bytes.Index(data, []byte("first"))] = 'F'
+		require.NoError(t, os.WriteFile(path, data, 0o644))
+
+		_, err = readchunkdump.NewReplayer(path)
+		require.ErrorIs(t, err, readchunkdump.ErrManifest)
+		require.ErrorContains(t, err, "chunk 0 has sha256")
+	})
+}
+
+func TestReplayerFS(t *testing.T) {
+	var recording bytes.Buffer
+	fr, err := readchunkdump.NewFileRecorder(&chunkReader{chunks: chunks}, &recording)
+	require.NoError(t, err)
+	drain(t, fr)
+	require.NoError(t, fr.Close())
+
+	fsys := fstest.MapFS{
+		"fixtures/recording":              {Data: recording.Bytes()},
+		"fixtures/chunks/chunk-0":         {Data: []byte("from ")},
+		"fixtures/chunks/chunk-1":         {Data: []byte("a map\n")},
+		"fixtures/broken/chunk-1":         {Data: []byte("gap")},
+		"fixtures/manifest/chunk-0":       {Data: []byte("x")},
+		"fixtures/manifest/manifest.json": {Data: []byte(`{"chunk_count": 1, "chunks": [{"size": 2}]}`)},
+	}
+
+	replayFS := func(root string) ([]string, error) {
+		r, err := readchunkdump.NewReplayerFS(fsys, root)
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+
+		var out []string
+		buf := make([]byte, 64)
+		for {
+			n, err := r.Read(buf)
+			if n > 0 || err == nil {
+				out = append(out, string(buf[:n]))
+			}
+			if err == io.EOF {
+				return out, nil
+			}
+			if err != nil {
+				return out, err
+			}
+		}
+	}
+
+	got, err := replayFS("fixtures/recording")
+	require.NoError(t, err)
+	require.Equal(t, chunks, got)
+
+	got, err = replayFS("fixtures/chunks")
+	require.NoError(t, err)
+	require.Equal(t, []string{"from ", "a map\n"}, got)
+
+	_, err = replayFS("fixtures/broken")
+	require.ErrorContains(t, err, "chunk-0 is missing")
+	_, err = replayFS("fixtures/manifest")
+	require.ErrorIs(t, err, readchunkdump.ErrManifest)
+	_, err = replayFS("fixtures/missing")
+	require.ErrorIs(t, err, fs.ErrNotExist)
+}
+
+func readChunks(t *testing.T, r io.Reader) []string {
+	var out []string
+	buf := make([]byte, 64)
+	for {
+		n, err := r.Read(buf)
+		if err == io.EOF {
+			return out
+		}
+		require.NoError(t, err)
+		out = append(out, string(buf[:n]))
+	}
+}
+
+func TestRechunker(t *testing.T) {
+	rc := readchunkdump.NewRechunker([]byte("ab\ncde\n\nf"), '\n')
+
+	for _, tc := range []struct {
+		pattern  readchunkdump.Pattern
+		param    uint64
+		expected []string
+	}{
+		{readchunkdump.PATTERN_WHOLE, 0, []string{"ab\ncde\n\nf"}},
+		{readchunkdump.PATTERN_SPLIT, 4, []string{"ab\nc", "de\n\nf"}},
+		{readchunkdump.PATTERN_SPLIT, 13, []string{"ab\nc", "de\n\nf"}},
+		{readchunkdump.PATTERN_FIXED, 3, []string{"ab\nc", "de\n\n", "f"}},
+		{readchunkdump.PATTERN_BEFORE_DELIM, 0, []string{"ab", "\ncde", "\n", "\nf"}},
+		{readchunkdump.PATTERN_AFTER_DELIM, 0, []string{"ab\n", "cde\n", "\n", "f"}},
+		{readchunkdump.PATTERN_ISOLATE_DELIM, 0, []string{"ab", "\n", "cde", "\n", "\n", "f"}},
+		// patterns wrap around
+		{readchunkdump.PATTERN_WHOLE + 7, 0, []string{"ab\ncde\n\nf"}},
+	} {
+		require.Equal(t, tc.expected, readChunks(t, rc.Pattern(tc.pattern, tc.param)), "%v", tc.pattern)
+	}
+
+	// random chunkings are reproducible
+	random := readChunks(t, rc.Pattern(readchunkdump.PATTERN_RANDOM, 42))
+	require.Equal(t, random, readChunks(t, rc.Pattern(readchunkdump.PATTERN_RANDOM, 42)))
+	require.Equal(t, "ab\ncde\n\nf", strings.Join(random, ""))
+
+	// a small buffer ends reads early
+	r := rc.Pattern(readchunkdump.PATTERN_WHOLE, 0)
+	buf := make([]byte, 4)
+	n, err := r.Read(buf)
+	require.NoError(t, err)
+	require.Equal(t, "ab\nc", string(buf[:n]))
+
+	var names []string
+	for name, r := range rc.All(2) {
+		names = append(names, name)
+		require.Equal(t, "ab\ncde\n\nf", strings.Join(readChunks(t, r), ""), name)
+	}
+	require.Equal(t, 1+8+8+2+3, len(names))
+	require.Contains(t, names, "split-8")
+	require.Contains(t, names, "random-1")
+}
+
+type fakeCorpus struct {
+	entries [][]any
+}
+
+func (c *fakeCorpus) Add(args ...any) {
+	c.entries = append(c.entries, args)
+}
+
+func TestAddSeeds(t *testing.T) {
+	corpus := &fakeCorpus{}
+	readchunkdump.AddSeeds(corpus, []byte("a\nb"))
+	require.Len(t, corpus.entries, 7)
+	for _, entry := range corpus.entries {
+		require.Equal(t, []byte("a\nb"), entry[0])
+		require.IsType(t, uint8(0), entry[1])
+		require.IsType(t, uint64(0), entry[2])
+	}
+
+	// recordings can be rechunked too
+	var recording bytes.Buffer
+	fr, err := readchunkdump.NewFileRecorder(&chunkReader{chunks: chunks}, &recording)
+	require.NoError(t, err)
+	drain(t, fr)
+	require.NoError(t, fr.Close())
+	rc, err := readchunkdump.NewRechunkerFS(fstest.MapFS{"rec": {Data: recording.Bytes()}}, "rec", '\n')
+	require.NoError(t, err)
+	require.Equal(t, []string{"first line\n", "second line\n", "third"}, readChunks(t, rc.Pattern(readchunkdump.PATTERN_AFTER_DELIM, 0)))
+}
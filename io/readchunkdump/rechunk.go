@@ -0,0 +1,219 @@
+package readchunkdump
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"iter"
+	"math/rand/v2"
+)
+
+// Pattern is a way of placing read boundaries in a byte stream.
+type Pattern uint8
+
+const (
+	// PATTERN_WHOLE returns the stream in one read
+	PATTERN_WHOLE Pattern = iota
+	// PATTERN_SPLIT splits the stream once, at param modulo its length
+	PATTERN_SPLIT
+	// PATTERN_FIXED returns reads of param%64+1 bytes
+	PATTERN_FIXED
+	// PATTERN_RANDOM returns reads of 1 to 16 bytes, seeded by param
+	PATTERN_RANDOM
+	// PATTERN_BEFORE_DELIM ends a read right before every delimiter
+	PATTERN_BEFORE_DELIM
+	// PATTERN_AFTER_DELIM ends a read right after every delimiter
+	PATTERN_AFTER_DELIM
+	// PATTERN_ISOLATE_DELIM returns every delimiter in a read of its own
+	PATTERN_ISOLATE_DELIM
+
+	patternCount
+)
+
+func (p Pattern) String() string {
+	switch p {
+	case PATTERN_WHOLE:
+		return "whole"
+	case PATTERN_SPLIT:
+		return "split"
+	case PATTERN_FIXED:
+		return "fixed"
+	case PATTERN_RANDOM:
+		return "random"
+	case PATTERN_BEFORE_DELIM:
+		return "before-delim"
+	case PATTERN_AFTER_DELIM:
+		return "after-delim"
+	case PATTERN_ISOLATE_DELIM:
+		return "isolate-delim"
+	}
+	return fmt.Sprintf("Pattern(%d)", uint8(p))
+}
+
+// Rechunker replays a byte stream under many read boundary patterns, to find
+// the bugs of a reader that only show up when a boundary falls in the wrong
+// place.
+type Rechunker struct {
+	data  []byte
+	delim byte
+}
+
+// NewRechunker rechunks data. delim is the delimiter of the delimiter
+// patterns, typically '\n'.
+func NewRechunker(data []byte, delim byte) *Rechunker {
+	return &Rechunker{data: data, delim: delim}
+}
+
+// NewRechunkerFS rechunks the bytes of the recording root of fsys. Recorded
+// errors other than io.EOF are returned.
+func NewRechunkerFS(fsys fs.FS, root string, delim byte) (*Rechunker, error) {
+	r, err := NewReplayerFS(fsys, root)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return NewRechunker(data, delim), nil
+}
+
+// Reader returns the stream with reads ending at the given increasing
+// offsets. A read also ends when the buffer is full.
+func (rc *Rechunker) Reader(boundaries []int) io.Reader {
+	return &chunkedReader{data: rc.data, boundaries: boundaries}
+}
+
+// Pattern returns the stream chunked with p. Out of range patterns wrap
+// around, so that fuzz targets can pass any value.
+func (rc *Rechunker) Pattern(p Pattern, param uint64) io.Reader {
+	return rc.Reader(rc.boundaries(p%patternCount, param))
+}
+
+func (rc *Rechunker) boundaries(p Pattern, param uint64) []int {
+	var out []int
+	switch p {
+	case PATTERN_SPLIT:
+		if len(rc.data) > 0 {
+			out = append(out, int(param%uint64(len(rc.data))))
+		}
+	case PATTERN_FIXED:
+		size := int(param%64) + 1
+		for at := size; at < len(rc.data); at += size {
+			out = append(out, at)
+		}
+	case PATTERN_RANDOM:
+		rng := rand.New(rand.NewPCG(param, param))
+		for at := 1 + rng.IntN(16); at < len(rc.data); at += 1 + rng.IntN(16) {
+			out = append(out, at)
+		}
+	case PATTERN_BEFORE_DELIM, PATTERN_AFTER_DELIM, PATTERN_ISOLATE_DELIM:
+		for at, c := range rc.data {
+			if c != rc.delim {
+				continue
+			}
+			if p != PATTERN_AFTER_DELIM {
+				out = append(out, at)
+			}
+			if p != PATTERN_BEFORE_DELIM {
+				out = append(out, at+1)
+			}
+		}
+	}
+	return out
+}
+
+// SingleSplits yields the stream split once at every offset.
+func (rc *Rechunker) SingleSplits() iter.Seq2[string, io.Reader] {
+	return func(yield func(string, io.Reader) bool) {
+		for at := 1; at < len(rc.data); at++ {
+			if !yield(fmt.Sprintf("split-%d", at), rc.Reader([]int{at})) {
+				return
+			}
+		}
+	}
+}
+
+// All yields the stream under every pattern: whole, every single split,
+// fixed sizes of 1 to 8 bytes, nrandom seeded chunkings and the delimiter
+// patterns. Names are suitable for t.Run.
+func (rc *Rechunker) All(nrandom int) iter.Seq2[string, io.Reader] {
+	return func(yield func(string, io.Reader) bool) {
+		if !yield(PATTERN_WHOLE.String(), rc.Pattern(PATTERN_WHOLE, 0)) {
+			return
+		}
+		for name, r := range rc.SingleSplits() {
+			if !yield(name, r) {
+				return
+			}
+		}
+		for size := uint64(1); size <= 8; size++ {
+			if !yield(fmt.Sprintf("fixed-%d", size), rc.Pattern(PATTERN_FIXED, size-1)) {
+				return
+			}
+		}
+		for seed := range uint64(nrandom) {
+			if !yield(fmt.Sprintf("random-%d", seed), rc.Pattern(PATTERN_RANDOM, seed)) {
+				return
+			}
+		}
+		for _, p := range []Pattern{PATTERN_BEFORE_DELIM, PATTERN_AFTER_DELIM, PATTERN_ISOLATE_DELIM} {
+			if !yield(p.String(), rc.Pattern(p, 0)) {
+				return
+			}
+		}
+	}
+}
+
+// FuzzCorpus is the part of testing.F used by AddSeeds.
+type FuzzCorpus interface {
+	Add(args ...any)
+}
+
+// AddSeeds adds data to the corpus of a fuzz target under every pattern, as
+// (data []byte, pattern uint8, param uint64) arguments; the target passes
+// them to Pattern:
+//
+//	f.Fuzz(func(t *testing.T, data []byte, pattern uint8, param uint64) {
+//		r := readchunkdump.NewRechunker(data, '\n').Pattern(readchunkdump.Pattern(pattern), param)
+//		...
+//	})
+func AddSeeds(f FuzzCorpus, data []byte) {
+	for p := range patternCount {
+		param := uint64(0)
+		if p == PATTERN_SPLIT {
+			param = uint64(len(data) / 2)
+		}
+		if p == PATTERN_FIXED {
+			param = 2
+		}
+		f.Add(bytes.Clone(data), uint8(p), param)
+	}
+}
+
+type chunkedReader struct {
+	data       []byte
+	boundaries []int
+	pos        int
+}
+
+func (r *chunkedReader) Read(dst []byte) (int, error) {
+	if r.pos >= len(r.data) {
+		return 0, io.EOF
+	}
+
+	end := len(r.data)
+	for len(r.boundaries) > 0 && r.boundaries[0] <= r.pos {
+		r.boundaries = r.boundaries[1:]
+	}
+	if len(r.boundaries) > 0 {
+		end = min(end, r.boundaries[0])
+	}
+
+	n := copy(dst, r.data[r.pos:end])
+	r.pos += n
+	return n, nil
+}
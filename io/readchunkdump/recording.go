@@ -0,0 +1,136 @@
+package readchunkdump
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Recording gives random access to the chunks of a recording file. Files
+// without an index, from a recorder that wasn't closed, are scanned once, and
+// end at their last complete record.
+type Recording struct {
+	f       *os.File
+	size    int64
+	kind    Kind
+	offsets []int64
+}
+
+func OpenRecording(path string) (*Recording, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	rec := &Recording{f: f}
+	if err := rec.load(); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return rec, nil
+}
+
+func (rec *Recording) load() error {
+	info, err := rec.f.Stat()
+	if err != nil {
+		return err
+	}
+	rec.size = info.Size()
+
+	rr, err := newRecordReader(io.NewSectionReader(rec.f, 0, rec.size))
+	if err != nil {
+		return err
+	}
+	rec.kind = rr.kind
+
+	if rec.size >= int64(headerSize+footerSize) {
+		footer := make([]byte, footerSize)
+		if _, err := rec.f.ReadAt(footer, rec.size-int64(footerSize)); err != nil {
+			return err
+		}
+		if string(footer[8:]) == magic {
+			return rec.loadIndex(int64(binary.LittleEndian.Uint64(footer)))
+		}
+	}
+
+	// no index, find the chunks
+	for {
+		off := rr.off
+		tag, _, err := rr.next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if tag == tagChunk {
+			rec.offsets = append(rec.offsets, off)
+		}
+	}
+}
+
+func (rec *Recording) loadIndex(off int64) error {
+	tag, index, err := rec.readRecordAt(off)
+	if err != nil {
+		return err
+	}
+	if tag != tagIndex {
+		return fmt.Errorf("%w: footer doesn't point to the index", ErrFormat)
+	}
+
+	count, n := binary.Uvarint(index)
+	if n <= 0 || count > uint64(len(index)) {
+		return fmt.Errorf("%w: bad index", ErrFormat)
+	}
+	index = index[n:]
+
+	rec.offsets = make([]int64, count)
+	for i := range rec.offsets {
+		chunkOff, n := binary.Uvarint(index)
+		if n <= 0 || chunkOff >= uint64(off) {
+			return fmt.Errorf("%w: bad index", ErrFormat)
+		}
+		rec.offsets[i] = int64(chunkOff)
+		index = index[n:]
+	}
+	return nil
+}
+
+func (rec *Recording) readRecordAt(off int64) (tag byte, payload []byte, err error) {
+	r := bufio.NewReader(io.NewSectionReader(rec.f, off, rec.size-off))
+	tag, payload, _, err = readRecord(r, off)
+	if err == io.EOF {
+		err = fmt.Errorf("%w: no record at %d", ErrFormat, off)
+	}
+	return tag, payload, err
+}
+
+func (rec *Recording) Kind() Kind {
+	return rec.kind
+}
+
+// Len returns the number of chunks.
+func (rec *Recording) Len() int {
+	return len(rec.offsets)
+}
+
+// Chunk returns the bytes of chunk i.
+func (rec *Recording) Chunk(i int) ([]byte, error) {
+	if i < 0 || i >= len(rec.offsets) {
+		return nil, fmt.Errorf("chunk %d out of range [0, %d)", i, len(rec.offsets))
+	}
+	tag, payload, err := rec.readRecordAt(rec.offsets[i])
+	if err != nil {
+		return nil, err
+	}
+	if tag != tagChunk {
+		return nil, fmt.Errorf("%w: chunk %d: index points to a record of tag %d", ErrFormat, i, tag)
+	}
+	return payload, nil
+}
+
+func (rec *Recording) Close() error {
+	return rec.f.Close()
+}
@@ -1,48 +1,158 @@
 package readchunkdump
 
 import (
-	"fmt"
-	"io"
-	"os"
-	"path"
+	"io/fs"
+	"time"
 )
 
+// Replayer returns the chunks of a recording, one per Read call, along with
+// the error recorded for the call. A chunk larger than the buffer of the Read
+// is returned over several calls, the error with its last part. Once the
+// recording is exhausted, it returns io.EOF. The recording is either a
+// recording file or a directory of chunk-N files. Of a conversation, only the
+// reads are replayed.
 type Replayer struct {
-	chunksdir string
-	nbChunks  int
-	idx       int
+	src   chunkSource
+	opts  replayOptions
+	start time.Duration
+
+	// rest of the current chunk, and its error
+	rest    []byte
+	restErr error
+	nreads  int
+}
+
+// TB is the part of testing.TB used by strict replays.
+type TB interface {
+	Helper()
+	Errorf(format string, args ...any)
+}
+
+type ReplayOption func(*replayOptions)
+
+type replayOptions struct {
+	timed  bool
+	scale  float64
+	clock  Clock
+	strict TB
+}
+
+// WithTiming reproduces the recorded spacing of the reads: a chunk isn't
+// returned before the time it was recorded at, scaled by scale, has elapsed
+// since the Replayer was created. A scale of 0.5 replays twice as fast. Without
+// it, chunks are returned immediately. Chunks without a recorded time, as in
+// chunk directories, are never delayed.
+func WithTiming(scale float64) ReplayOption {
+	return func(o *replayOptions) {
+		o.timed = true
+		o.scale = scale
+	}
+}
+
+// WithClock paces a timed replay with clock instead of the wall clock, see
+// VirtualClock.
+func WithClock(clock Clock) ReplayOption {
+	return func(o *replayOptions) {
+		o.clock = clock
+	}
+}
+
+// WithStrict reports an error to tb whenever a Read starts a chunk with a
+// buffer of another size than the recorded one, so that a test notices when
+// the consumer under test no longer reads like the recorded one did. Chunks
+// without a recorded buffer size, as in chunk directories, are only checked to
+// fit into the buffer, since the recorded one was at least as large.
+func WithStrict(tb TB) ReplayOption {
+	return func(o *replayOptions) {
+		o.strict = tb
+	}
+}
+
+// NewReplayer replays the recording file or chunk directory at path
+// recording. Recordings of writes are rejected with a *KindError, see
+// ReplayWrites.
+func NewReplayer(recording string, opts ...ReplayOption) (*Replayer, error) {
+	fsys, name := osPath(recording)
+	return NewReplayerFS(fsys, name, opts...)
 }
 
-func NewReplayer(chunksdir string) (*Replayer, error) {
-	chunks, err := os.ReadDir(chunksdir)
+// NewReplayerFS replays the recording root of fsys, such as an embed.FS.
+func NewReplayerFS(fsys fs.FS, root string, opts ...ReplayOption) (*Replayer, error) {
+	return newReplayer(fsys, root, opts, KIND_READS, KIND_CONVERSATION)
+}
+
+func newReplayer(fsys fs.FS, root string, opts []ReplayOption, kinds ...Kind) (*Replayer, error) {
+	src, err := openSource(fsys, root, kinds...)
 	if err != nil {
 		return nil, err
 	}
 
-	return &Replayer{
-		chunksdir: chunksdir,
-		nbChunks:  len(chunks),
-	}, nil
+	o := replayOptions{clock: realClock{start: time.Now()}}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return &Replayer{src: src, opts: o, start: o.clock.Now()}, nil
+}
+
+// Manifest returns the manifest the recording was checked against, nil if it
+// has none.
+func (r *Replayer) Manifest() *Manifest {
+	return r.src.manifest()
 }
 
 func (r *Replayer) Read(dst []byte) (n int, err error) {
-	if r.idx >= r.nbChunks {
-		err = io.EOF
-		return
+	if len(r.rest) == 0 {
+		c, err := r.next()
+		if err != nil {
+			return 0, err
+		}
+		r.checkBufSize(c, len(dst))
+		r.rest, r.restErr = c.data, c.err
 	}
 
-	var data []byte
-	data, err = os.ReadFile(
-		path.Join(r.chunksdir, fmt.Sprintf("chunk-%d", r.idx)),
-	)
-	n = len(data)
+	n = copy(dst, r.rest)
+	r.rest = r.rest[n:]
+	if len(r.rest) > 0 {
+		return n, nil
+	}
+	return n, r.restErr
+}
 
-	if err != nil {
+func (r *Replayer) checkBufSize(c chunk, size int) {
+	r.nreads++
+	if r.opts.strict == nil {
 		return
 	}
+	r.opts.strict.Helper()
+	switch {
+	case c.bufSize < 0 && size < len(c.data):
+		r.opts.strict.Errorf("readchunkdump: read %d has a buffer of %d bytes, smaller than its chunk of %d", r.nreads, size, len(c.data))
+	case c.bufSize >= 0 && c.bufSize != size:
+		r.opts.strict.Errorf("readchunkdump: read %d has a buffer of %d bytes, recorded with %d", r.nreads, size, c.bufSize)
+	}
+}
+
+// next returns the next chunk once it is due. The writes of conversations are
+// skipped, see ConnReplayer.
+func (r *Replayer) next() (chunk, error) {
+	c, err := r.src.next()
+	for err == nil && c.write {
+		c, err = r.src.next()
+	}
+	if err == nil && r.opts.timed && c.hasTime {
+		r.wait(c.at)
+	}
+	return c, err
+}
 
-	copy(dst, data)
+// wait sleeps until the replay reaches the recording time at.
+func (r *Replayer) wait(at time.Duration) {
+	target := r.start + time.Duration(float64(at)*r.opts.scale)
+	if now := r.opts.clock.Now(); now < target {
+		r.opts.clock.Sleep(target - now)
+	}
+}
 
-	r.idx++
-	return
+func (r *Replayer) Close() error {
+	return r.src.Close()
 }
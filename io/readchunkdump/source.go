@@ -0,0 +1,318 @@
+package readchunkdump
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// chunk is a recorded call.
+type chunk struct {
+	data []byte
+
+	// at is when the call returned, relative to the start of the recording
+	at      time.Duration
+	hasTime bool
+
+	// err is the recorded error of the call
+	err error
+
+	// bufSize is the size of the buffer passed to Read, -1 if unknown
+	bufSize int
+
+	// write is set for the calls to Write of a conversation
+	write bool
+}
+
+// chunkSource yields the recorded chunks in order, and io.EOF after the last.
+// A recorded io.EOF is in chunk.err, not returned by next.
+type chunkSource interface {
+	next() (chunk, error)
+	// manifest returns the manifest the recording was checked against, nil if
+	// it has none
+	manifest() *Manifest
+	kind() Kind
+	Close() error
+}
+
+// openSource opens the recording file, or directory of chunk-N files, name of
+// fsys, and checks it against its manifest. The recording must be of one of
+// the kinds.
+func openSource(fsys fs.FS, name string, kinds ...Kind) (chunkSource, error) {
+	isFile, err := isRecordingFile(fsys, name)
+	if err != nil {
+		return nil, err
+	}
+
+	var src chunkSource
+	if isFile {
+		src, err = newFileSource(fsys, name)
+	} else {
+		src, err = newDirSource(fsys, name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !slices.Contains(kinds, src.kind()) {
+		src.Close()
+		return nil, fmt.Errorf("%s: %w", name, &KindError{Kind: src.kind(), Expected: kinds})
+	}
+	return src, nil
+}
+
+// osPath splits a path of the OS into a file system and a name in it.
+func osPath(p string) (fs.FS, string) {
+	p = filepath.Clean(p)
+	dir := filepath.Dir(p)
+	if dir == p {
+		// the root has no parent to be a name in
+		return os.DirFS(p), "."
+	}
+	return os.DirFS(dir), filepath.Base(p)
+}
+
+type dirSource struct {
+	fsys      fs.FS
+	chunksdir string
+	nbChunks  int
+	idx       int
+	m         *Manifest
+}
+
+func newDirSource(fsys fs.FS, chunksdir string) (*dirSource, error) {
+	s := &dirSource{fsys: fsys, chunksdir: chunksdir}
+	if err := s.check(); err != nil {
+		return nil, fmt.Errorf("%s: %w", chunksdir, err)
+	}
+	return s, nil
+}
+
+// errSuffix is appended to the name of a chunk-N file for the file holding the
+// error of the call.
+const errSuffix = ".err"
+
+// check makes sure the directory holds chunk-0 to chunk-N, the errors of some
+// of them and nothing else, and that they match the manifest if there is one.
+func (s *dirSource) check() error {
+	entries, err := fs.ReadDir(s.fsys, s.chunksdir)
+	if err != nil {
+		return err
+	}
+	if s.m, err = readManifest(s.fsys, s.chunksdir); err != nil {
+		return err
+	}
+
+	present := map[int]bool{}
+	var errs []int
+	for _, entry := range entries {
+		if entry.Name() == manifestName {
+			continue
+		}
+		name, isErr := strings.CutSuffix(entry.Name(), errSuffix)
+		i, ok := chunkIndex(name)
+		if !ok {
+			return fmt.Errorf("%w: stray file %q", ErrFormat, entry.Name())
+		}
+		if isErr {
+			errs = append(errs, i)
+		} else {
+			present[i] = true
+		}
+	}
+	s.nbChunks = len(present)
+	for i := range s.nbChunks {
+		if !present[i] {
+			return fmt.Errorf("%w: chunk-%d is missing", ErrFormat, i)
+		}
+	}
+	for _, i := range errs {
+		if !present[i] {
+			return fmt.Errorf("%w: chunk-%d%s has no chunk", ErrFormat, i, errSuffix)
+		}
+	}
+
+	if s.m == nil {
+		return nil
+	}
+	chunks := make([]ChunkInfo, s.nbChunks)
+	for i := range chunks {
+		data, err := fs.ReadFile(s.fsys, path.Join(s.chunksdir, fmt.Sprintf("chunk-%d", i)))
+		if err != nil {
+			return err
+		}
+		chunks[i] = chunkInfo(data)
+	}
+	return s.m.check(chunks)
+}
+
+// chunkIndex parses the name of chunk-N files.
+func chunkIndex(name string) (int, bool) {
+	digits, ok := strings.CutPrefix(name, "chunk-")
+	if !ok {
+		return 0, false
+	}
+	i, err := strconv.Atoi(digits)
+	if err != nil || i < 0 || strconv.Itoa(i) != digits {
+		return 0, false
+	}
+	return i, true
+}
+
+func (s *dirSource) next() (chunk, error) {
+	if s.idx >= s.nbChunks {
+		return chunk{}, io.EOF
+	}
+
+	name := path.Join(s.chunksdir, fmt.Sprintf("chunk-%d", s.idx))
+	data, err := fs.ReadFile(s.fsys, name)
+	if err != nil {
+		return chunk{}, err
+	}
+	c := chunk{data: data, bufSize: -1}
+
+	payload, err := fs.ReadFile(s.fsys, name+errSuffix)
+	switch {
+	case err == nil:
+		if c.err, err = decodeErr(payload); err != nil {
+			return chunk{}, fmt.Errorf("%s%s: %w", name, errSuffix, err)
+		}
+	case !errors.Is(err, fs.ErrNotExist):
+		return chunk{}, err
+	}
+	s.idx++
+	return c, nil
+}
+
+func (s *dirSource) manifest() *Manifest {
+	return s.m
+}
+
+// kind of chunk directories is always KIND_READS.
+func (s *dirSource) kind() Kind {
+	return KIND_READS
+}
+
+func (s *dirSource) Close() error {
+	return nil
+}
+
+type fileSource struct {
+	f  fs.File
+	rr *recordReader
+	m  *Manifest
+}
+
+func newFileSource(fsys fs.FS, name string) (*fileSource, error) {
+	s := &fileSource{}
+	if err := s.check(fsys, name); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+
+	f, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	if s.rr, err = newRecordReader(f); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	s.f = f
+	return s, nil
+}
+
+// check scans the recording once to compare it to its manifest. Recordings
+// that weren't closed have no manifest.
+func (s *fileSource) check(fsys fs.FS, name string) error {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	rr, err := newRecordReader(f)
+	if err != nil {
+		return err
+	}
+
+	var chunks []ChunkInfo
+	for {
+		tag, payload, err := rr.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		switch tag {
+		case tagChunk:
+			chunks = append(chunks, chunkInfo(payload))
+		case tagManifest:
+			if s.m, err = decodeManifest(payload); err != nil {
+				return err
+			}
+		}
+	}
+	if s.m != nil {
+		return s.m.check(chunks)
+	}
+	return nil
+}
+
+func (s *fileSource) next() (chunk, error) {
+	c := chunk{bufSize: -1}
+	for {
+		tag, payload, err := s.rr.next()
+		if err != nil {
+			return chunk{}, err
+		}
+
+		switch tag {
+		case tagTime:
+			at, n := binary.Uvarint(payload)
+			if n <= 0 {
+				return chunk{}, fmt.Errorf("%w: bad time record", ErrFormat)
+			}
+			c.at, c.hasTime = time.Duration(at), true
+		case tagBufSize:
+			size, n := binary.Uvarint(payload)
+			if n <= 0 || size > maxPayloadSize {
+				return chunk{}, fmt.Errorf("%w: bad buffer size record", ErrFormat)
+			}
+			c.bufSize = int(size)
+		case tagErr:
+			if c.err, err = decodeErr(payload); err != nil {
+				return chunk{}, err
+			}
+		case tagDirection:
+			c.write = len(payload) == 1 && payload[0] == directionWrite
+		case tagDropped:
+			count, _ := binary.Uvarint(payload)
+			return chunk{}, fmt.Errorf("%w: %d before chunk at %d", ErrDropped, count, s.rr.off)
+		case tagChunk:
+			c.data = payload
+			return c, nil
+		}
+	}
+}
+
+func (s *fileSource) manifest() *Manifest {
+	return s.m
+}
+
+func (s *fileSource) kind() Kind {
+	return s.rr.kind
+}
+
+func (s *fileSource) Close() error {
+	return s.f.Close()
+}
@@ -0,0 +1,61 @@
+package readchunkdump
+
+import "io"
+
+// WriteRecorder records the Write calls made to w: each call appends a chunk
+// record holding the bytes w took, with the time the call returned and its
+// error. w may be io.Discard to only record. Like FileRecorder, the first
+// recording error stops the recording and is returned by Close.
+type WriteRecorder struct {
+	w io.Writer
+	recordingFile
+}
+
+func NewWriteRecorder(w io.Writer, out io.Writer, opts ...RecordOption) (*WriteRecorder, error) {
+	wr := &WriteRecorder{w: w}
+	return wr, wr.init(out, KIND_WRITES, wr.manifest(opts))
+}
+
+// CreateWriteRecorder records into a new file at path.
+func CreateWriteRecorder(w io.Writer, path string, opts ...RecordOption) (*WriteRecorder, error) {
+	wr := &WriteRecorder{w: w}
+	return wr, wr.create(path, KIND_WRITES, wr.manifest(opts))
+}
+
+func (wr *WriteRecorder) manifest(opts []RecordOption) Manifest {
+	return newManifest(opts, map[string]string{"recorder": "readchunkdump.WriteRecorder"})
+}
+
+func (wr *WriteRecorder) Write(p []byte) (n int, err error) {
+	n, err = wr.w.Write(p)
+	wr.record(p[:n], err, -1)
+	return
+}
+
+// ReplayWrites drives w with the recorded chunks, one Write call per chunk,
+// paced like the reads of a Replayer. Recorded errors are not replayed. It
+// stops at the first error returned by w.
+func ReplayWrites(recording string, w io.Writer, opts ...ReplayOption) (written int64, err error) {
+	fsys, name := osPath(recording)
+	r, err := newReplayer(fsys, name, opts, KIND_WRITES)
+	if err != nil {
+		return 0, err
+	}
+	defer r.Close()
+
+	for {
+		c, err := r.next()
+		if err == io.EOF {
+			return written, nil
+		}
+		if err != nil {
+			return written, err
+		}
+
+		n, err := w.Write(c.data)
+		written += int64(n)
+		if err != nil {
+			return written, err
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package topk
+
+// minHexWordLen is the shortest hex word MaskNumbers masks, so that short
+// words made of hex letters like "bad" or "cafe" are kept.
+const minHexWordLen = 8
+
+// MaskNumbers is a Normalizer that replaces the parts of a line that usually
+// vary between otherwise identical messages:
+//   - 0x prefixed hex numbers become "0x#"
+//   - words of at least 8 hex digits, such as hashes, become "#"
+//   - runs of decimal digits become "#", unless they are part of an
+//     identifier such as x86_64
+func MaskNumbers(dst, line []byte) []byte {
+	for i := 0; i < len(line); {
+		c := line[i]
+
+		if c == '0' && i+2 < len(line) && (line[i+1] == 'x' || line[i+1] == 'X') && isHex(line[i+2]) {
+			i += 2
+			for i < len(line) && isHex(line[i]) {
+				i++
+			}
+			dst = append(dst, "0x#"...)
+			continue
+		}
+
+		if isHex(c) && (i == 0 || !isWord(line[i-1])) {
+			end := i
+			hasDigit := false
+			for end < len(line) && isHex(line[end]) {
+				hasDigit = hasDigit || isDigit(line[end])
+				end++
+			}
+			if end-i >= minHexWordLen && hasDigit && (end == len(line) || !isWord(line[end])) {
+				dst = append(dst, '#')
+				i = end
+				continue
+			}
+		}
+
+		if isDigit(c) {
+			start := i
+			for i < len(line) && isDigit(line[i]) {
+				i++
+			}
+			// digits within identifiers, such as x86_64, are kept
+			if start > 0 && isWord(line[start-1]) && !isDigit(line[start-1]) {
+				dst = append(dst, line[start:i]...)
+			} else {
+				dst = append(dst, '#')
+			}
+			continue
+		}
+
+		dst = append(dst, c)
+		i++
+	}
+	return dst
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isHex(c byte) bool {
+	return isDigit(c) || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+func isWord(c byte) bool {
+	return isHex(c) || (c >= 'g' && c <= 'z') || (c >= 'G' && c <= 'Z') || c == '_'
+}
@@ -0,0 +1,141 @@
+// Package topk finds the most frequent lines of a stream in bounded memory
+// using the Space-Saving algorithm.
+package topk
+
+import (
+	"cmp"
+	"container/heap"
+	"fmt"
+	"slices"
+
+	"github.com/asymmetric-research/go-commons/io/framer"
+)
+
+// Normalizer appends the normalized form of line to dst and returns it.
+type Normalizer func(dst, line []byte) []byte
+
+type Item struct {
+	Line  string
+	Count uint64
+	// Err bounds how much Count overestimates the real count: the line was
+	// seen between Count-Err and Count times.
+	Err uint64
+}
+
+type entry struct {
+	Item
+	heapidx int
+}
+
+// T counts at most k distinct lines. A line seen more than Total()/k times is
+// guaranteed to be counted.
+type T struct {
+	k         int
+	normalize Normalizer
+	scratch   []byte
+	total     uint64
+
+	entries map[string]*entry
+	// bycount is a min-heap of the entries, on their count
+	bycount entryHeap
+}
+
+// New creates a counter of k lines. If normalize isn't nil, lines are counted
+// by their normalized form.
+func New(k int, normalize Normalizer) (*T, error) {
+	ret := &T{}
+	return ret, NewInto(ret, k, normalize)
+}
+
+func NewInto(dst *T, k int, normalize Normalizer) error {
+	if k <= 0 {
+		return fmt.Errorf("k must be greater than zero")
+	}
+	*dst = T{
+		k:         k,
+		normalize: normalize,
+		entries:   make(map[string]*entry, k),
+		bycount:   make(entryHeap, 0, k),
+	}
+	return nil
+}
+
+func (t *T) Add(line []byte) {
+	if t.normalize != nil {
+		t.scratch = t.normalize(t.scratch[:0], line)
+		line = t.scratch
+	}
+	t.total++
+
+	if e, ok := t.entries[string(line)]; ok {
+		e.Count++
+		heap.Fix(&t.bycount, e.heapidx)
+		return
+	}
+
+	if len(t.bycount) < t.k {
+		e := &entry{Item: Item{Line: string(line), Count: 1}}
+		t.entries[e.Line] = e
+		heap.Push(&t.bycount, e)
+		return
+	}
+
+	// replace the least counted line, inheriting its count as error
+	e := t.bycount[0]
+	delete(t.entries, e.Line)
+	e.Err = e.Count
+	e.Count++
+	e.Line = string(line)
+	t.entries[e.Line] = e
+	heap.Fix(&t.bycount, 0)
+}
+
+// Consume adds every line of src, see framer.Each.
+func (t *T) Consume(src framer.Framer, line []byte) (ndiscarded int, err error) {
+	return framer.Each(src, line, t.Add)
+}
+
+// Total returns the number of lines added.
+func (t *T) Total() uint64 {
+	return t.total
+}
+
+// Top returns the n most counted lines, most frequent first. It returns nil
+// when n isn't positive.
+func (t *T) Top(n int) []Item {
+	if n <= 0 {
+		return nil
+	}
+	items := make([]Item, len(t.bycount))
+	for i, e := range t.bycount {
+		items[i] = e.Item
+	}
+	slices.SortFunc(items, func(a, b Item) int {
+		if c := cmp.Compare(b.Count, a.Count); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Line, b.Line)
+	})
+	return items[:min(n, len(items))]
+}
+
+type entryHeap []*entry
+
+func (h entryHeap) Len() int           { return len(h) }
+func (h entryHeap) Less(i, j int) bool { return h[i].Count < h[j].Count }
+func (h entryHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].heapidx = i
+	h[j].heapidx = j
+}
+func (h *entryHeap) Push(x any) {
+	e := x.(*entry)
+	e.heapidx = len(*h)
+	*h = append(*h, e)
+}
+func (h *entryHeap) Pop() any {
+	old := *h
+	e := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return e
+}
@@ -0,0 +1,90 @@
+package topk_test
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"testing"
+
+	"github.com/asymmetric-research/go-commons/io/linereader"
+	"github.com/asymmetric-research/go-commons/io/topk"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTopK(t *testing.T) {
+	rng := rand.New(rand.NewPCG(5, 6))
+
+	// a few heavy hitters drowned in noise
+	var lines []string
+	exact := map[string]uint64{}
+	for i := range 20000 {
+		var line string
+		switch {
+		case i%5 == 0:
+			line = "error: out of memory"
+		case i%7 == 0:
+			line = "error: timeout"
+		case i%11 == 0:
+			line = "warning: slow read"
+		default:
+			line = fmt.Sprintf("noise %d", rng.IntN(5000))
+		}
+		lines = append(lines, line)
+		exact[line]++
+	}
+
+	tk, err := topk.New(50, nil)
+	require.NoError(t, err)
+	lr := linereader.New(strings.NewReader(strings.Join(lines, "\n")), 4096)
+	discarded, err := tk.Consume(lr, make([]byte, 256))
+	require.NoError(t, err)
+	require.Zero(t, discarded)
+	require.Equal(t, uint64(len(lines)), tk.Total())
+
+	top := tk.Top(3)
+	require.Len(t, top, 3)
+	require.Equal(t, "error: out of memory", top[0].Line)
+	require.Equal(t, "error: timeout", top[1].Line)
+	require.Equal(t, "warning: slow read", top[2].Line)
+
+	for _, item := range tk.Top(50) {
+		require.LessOrEqual(t, item.Count-item.Err, exact[item.Line], item.Line)
+		require.GreaterOrEqual(t, item.Count, exact[item.Line], item.Line)
+	}
+}
+
+func TestTopKExactWhenFitting(t *testing.T) {
+	tk, err := topk.New(3, nil)
+	require.NoError(t, err)
+	for _, line := range []string{"a", "b", "a", "c", "a", "b"} {
+		tk.Add([]byte(line))
+	}
+	require.Equal(t, []topk.Item{
+		{Line: "a", Count: 3},
+		{Line: "b", Count: 2},
+		{Line: "c", Count: 1},
+	}, tk.Top(10))
+	require.Empty(t, tk.Top(0))
+	require.Empty(t, tk.Top(-1))
+
+	_, err = topk.New(0, nil)
+	require.Error(t, err)
+}
+
+func TestMaskNumbers(t *testing.T) {
+	for in, expected := range map[string]string{
+		"fault at 0x0000555555693755 in thread 12":          "fault at 0x# in thread #",
+		"crash-1036e40820c11936e0b8d3069623cbecad6b6b95":    "crash-#",
+		"took 233.509096ms, mem=1KB":                        "took #.#ms, mem=#KB",
+		"deadbeef is a word, so is cafe and x86_64":         "deadbeef is a word, so is cafe and x86_64",
+		"id b6ddbbeed2004ab4e3095bc588be36a0 and 0xZZ done": "id # and #xZZ done",
+	} {
+		require.Equal(t, expected, string(topk.MaskNumbers(nil, []byte(in))), in)
+	}
+
+	tk, err := topk.New(10, topk.MaskNumbers)
+	require.NoError(t, err)
+	tk.Add([]byte("fault at 0x1234"))
+	tk.Add([]byte("fault at 0xabcd"))
+	require.Equal(t, []topk.Item{{Line: "fault at 0x#", Count: 2}}, tk.Top(1))
+}